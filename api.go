@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/html"
+
+	"github.com/asciimoo/morty/decompress"
+)
+
+// API_FETCH_PATH is the JSON API which returns the sanitized content of a page. The url parameter
+// is the page URL, and the hash parameter its HMAC when a key is set.
+const API_FETCH_PATH = "/api/v1/fetch"
+
+type APIFetchResponse struct {
+	URL         string    `json:"url"` // final URL, after the redirects
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type"`
+	Title       string    `json:"title"`
+	HTML        string    `json:"html"`
+	Links       []APILink `json:"links"`
+	Timing      APITiming `json:"timing"`
+}
+
+type APILink struct {
+	URL  string `json:"url"`
+	Text string `json:"text"`
+}
+
+// APITiming lists durations in milliseconds.
+type APITiming struct {
+	Upstream int64 `json:"upstream_ms"`
+	Sanitize int64 `json:"sanitize_ms"`
+	Total    int64 `json:"total_ms"`
+}
+
+type APIError struct {
+	Error string `json:"error"`
+}
+
+func (p *Proxy) serveAPIFetch(ctx *fasthttp.RequestCtx) {
+	start := time.Now()
+
+	if !ctx.IsGet() {
+		ctx.Response.Header.Set("Allow", "GET")
+		// HTTP status code 405 : Method Not Allowed
+		p.serveAPIError(ctx, 405, errors.New("method not allowed"))
+		return
+	}
+
+	requestURI := ctx.QueryArgs().Peek("url")
+	if len(requestURI) == 0 {
+		// HTTP status code 400 : Bad Request
+		p.serveAPIError(ctx, 400, errors.New(`missing "url" parameter`))
+		return
+	}
+	if p.Key != nil {
+		if !verifyRequestURI(requestURI, ctx.QueryArgs().Peek("hash"), p.Key) {
+			// HTTP status code 403 : Forbidden
+			p.serveAPIError(ctx, 403, errors.New(`invalid "hash" parameter`))
+			return
+		}
+	}
+
+	u, err := url.Parse(string(requestURI))
+	if err == nil && u.Scheme == "" {
+		u, err = url.Parse("https://" + string(requestURI))
+	}
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || strings.HasSuffix(u.Host, ".onion") {
+		// HTTP status code 400 : Bad Request
+		p.serveAPIError(ctx, 400, errors.New("unsupported URL"))
+		return
+	}
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	result := &APIFetchResponse{}
+	upstreamStart := time.Now()
+	u, statusCode, err := p.fetchAPI(ctx, u, resp)
+	result.Timing.Upstream = time.Since(upstreamStart).Milliseconds()
+	if err != nil {
+		p.serveAPIError(ctx, statusCode, err)
+		return
+	}
+	result.URL = u.String()
+	result.Status = resp.StatusCode()
+
+	body, err := decompressResponseBody(resp)
+	if err != nil {
+		// HTTP status code 503 : Service Unavailable
+		p.serveAPIError(ctx, 503, err)
+		return
+	}
+
+	contentType, contentTypeString := responseContentType(resp, body)
+	if contentType.SubType == "html" && contentType.Suffix == "" {
+		sanitizeStart := time.Now()
+		body, err = convertResponseBody(body, &contentType, contentTypeString)
+		if err != nil {
+			// HTTP status code 503 : Service Unavailable
+			p.serveAPIError(ctx, 503, err)
+			return
+		}
+
+		// the links of the document go to the proxy, not to the API
+		out := bytes.NewBuffer(nil)
+		if err := p.newFragmentSanitizer(ctx, u).HTML(out, bytes.NewReader(body)); err != nil && cfg.Debug {
+			log.Println("failed to parse HTML", err)
+		}
+		result.HTML = out.String()
+		result.Title, result.Links = extractMetadata(u, body)
+		result.Timing.Sanitize = time.Since(sanitizeStart).Milliseconds()
+	}
+	contentType.FilterParameters(ALLOWED_CONTENTTYPE_PARAMETERS)
+	result.ContentType = contentType.String()
+	if result.Links == nil {
+		result.Links = []APILink{}
+	}
+	result.Timing.Total = time.Since(start).Milliseconds()
+
+	ctx.SetContentType("application/json; charset=UTF-8")
+	json.NewEncoder(ctx).Encode(result)
+}
+
+// fetchAPI requests u with the GET method, follows the redirects and returns the final URL. When it
+// fails, it returns the HTTP status code of the error.
+func (p *Proxy) fetchAPI(ctx *fasthttp.RequestCtx, u *url.URL, resp *fasthttp.Response) (*url.URL, int, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	visited := make(map[string]bool)
+	for {
+		requestURIStr := u.String()
+		if cfg.Debug {
+			log.Println("API GET", requestURIStr)
+		}
+		visited[requestURIStr] = true
+
+		req.Reset()
+		req.SetConnectionClose()
+		req.SetRequestURI(requestURIStr)
+		p.Headers.Apply(u.Hostname(), &ctx.Request.Header, &req.Header)
+		req.Header.Set("Accept-Encoding", decompress.ACCEPT_ENCODING)
+		resp.Reset()
+		if statusCode, err := p.doUpstream(req, resp, u.Hostname()); err != nil {
+			return nil, statusCode, err
+		}
+
+		switch resp.StatusCode() {
+		case 301, 302, 303, 307, 308:
+		default:
+			return u, 200, nil
+		}
+		loc := resp.Header.Peek("Location")
+		if loc == nil {
+			return u, 200, nil
+		}
+		next, err := url.Parse(string(loc))
+		if err != nil {
+			// HTTP status code 502 : Bad Gateway
+			return nil, 502, errors.New("invalid redirect location")
+		}
+		next = u.ResolveReference(next)
+		next.Fragment = ""
+		if next.Scheme != "http" && next.Scheme != "https" {
+			return nil, 502, errors.New("invalid redirect location")
+		}
+		if len(visited) > MAX_REDIRECT_COUNT {
+			return nil, 310, errors.New("Too many redirects")
+		}
+		if visited[next.String()] {
+			return nil, 310, errors.New("Redirect loop: " + next.String())
+		}
+		u = next
+	}
+}
+
+// extractMetadata returns the title and the HTTP links of an HTML document. The link URLs are
+// absolute, and the whitespaces of the texts are collapsed.
+func extractMetadata(baseURL *url.URL, body []byte) (string, []APILink) {
+	var title string
+	links := []APILink{}
+	decoder := html.NewTokenizer(bytes.NewReader(body))
+	var text *strings.Builder
+	var link *APILink
+	inTitle := false
+	for {
+		token := decoder.Next()
+		switch token {
+		case html.ErrorToken:
+			if err := decoder.Err(); err != io.EOF && cfg.Debug {
+				log.Println("failed to parse HTML", err)
+			}
+			return title, links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag, hasAttrs := decoder.TagName()
+			switch string(tag) {
+			case "title":
+				if title == "" && token == html.StartTagToken {
+					inTitle = true
+					text = &strings.Builder{}
+				}
+			case "base", "a":
+				var href []byte
+				for hasAttrs {
+					var attrName, attrValue []byte
+					attrName, attrValue, hasAttrs = decoder.TagAttr()
+					if string(attrName) == "href" {
+						href = attrValue
+					}
+				}
+				if href == nil {
+					break
+				}
+				hrefURL, err := url.Parse(strings.TrimSpace(string(href)))
+				if err != nil {
+					break
+				}
+				hrefURL = baseURL.ResolveReference(hrefURL)
+				if string(tag) == "base" {
+					baseURL = hrefURL
+				} else if (hrefURL.Scheme == "http" || hrefURL.Scheme == "https") && token == html.StartTagToken {
+					link = &APILink{URL: hrefURL.String()}
+					text = &strings.Builder{}
+				}
+			}
+		case html.TextToken:
+			if text != nil {
+				text.Write(decoder.Text())
+			}
+		case html.EndTagToken:
+			tag, _ := decoder.TagName()
+			switch {
+			case string(tag) == "title" && inTitle:
+				title = strings.Join(strings.Fields(text.String()), " ")
+				inTitle = false
+				text = nil
+			case string(tag) == "a" && link != nil:
+				link.Text = strings.Join(strings.Fields(text.String()), " ")
+				links = append(links, *link)
+				link = nil
+				text = nil
+			}
+		}
+	}
+}
+
+func (p *Proxy) serveAPIError(ctx *fasthttp.RequestCtx, statusCode int, err error) {
+	if cfg.Debug {
+		log.Println("API error:", err)
+	}
+	ctx.SetContentType("application/json; charset=UTF-8")
+	ctx.SetStatusCode(statusCode)
+	json.NewEncoder(ctx).Encode(APIError{err.Error()})
+}
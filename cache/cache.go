@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"time"
+)
+
+// Entry is a cached proxy response: the sanitized body as it is sent to the client.
+//
+// ETag and LastModified are the validators sent by the upstream server. They are only used to
+// revalidate a stale entry and must never be sent to the client.
+type Entry struct {
+	ContentType  string
+	Body         []byte
+	Expires      time.Time
+	ETag         string
+	LastModified string
+}
+
+// Fresh reports whether the entry can be served without asking the upstream server.
+func (entry *Entry) Fresh(now time.Time) bool {
+	return now.Before(entry.Expires)
+}
+
+// Revalidable reports whether the upstream server can be asked if a stale entry is still valid.
+func (entry *Entry) Revalidable() bool {
+	return entry.ETag != "" || entry.LastModified != ""
+}
+
+// Cache stores proxied responses. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the entry stored for key, or false if there is none.
+	Get(key string) (*Entry, bool)
+	// Set stores entry for key, replacing any previous entry.
+	Set(key string, entry *Entry) error
+	// Delete removes the entry stored for key, if any.
+	Delete(key string) error
+}
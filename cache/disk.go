@@ -0,0 +1,486 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	objectsDirName = "objects"
+	tmpDirName     = "tmp"
+	indexFileName  = "index"
+)
+
+// ErrEntryTooLarge is returned by Set for a body larger than the maximum size of the cache.
+var ErrEntryTooLarge = errors.New("cache entry is larger than the cache size")
+
+// record is one line of the index journal.
+type record struct {
+	Op           string    `json:"op"`
+	Key          string    `json:"key"`
+	Hash         string    `json:"hash,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	Expires      time.Time `json:"expires"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	LastAccess   time.Time `json:"last_access"`
+}
+
+type diskEntry struct {
+	key          string
+	hash         string
+	size         int64
+	contentType  string
+	expires      time.Time
+	etag         string
+	lastModified string
+	lastAccess   time.Time
+	element      *list.Element
+}
+
+// DiskCache is a Cache storing the bodies in content-addressed files below a directory.
+//
+// The metadata is kept in memory and persisted in an append-only journal which is compacted
+// when the cache is opened and when it grows too much. Bodies are written to a temporary file
+// and renamed, so a crash never leaves a partially written object behind: at worst, the last
+// journal line is truncated and ignored, and objects without an index entry are removed on the
+// next start.
+//
+// When the total size of the stored bodies exceeds the maximum size, the least recently used
+// entries are evicted.
+type DiskCache struct {
+	dir     string
+	maxSize int64
+
+	mu             sync.Mutex
+	entries        map[string]*diskEntry
+	objects        map[string]int // hash -> number of entries referencing the object
+	size           int64
+	lru            *list.List // front is the most recently used entry
+	journal        *os.File
+	journalRecords int
+}
+
+// NewDiskCache opens (or creates) the cache stored in dir.
+func NewDiskCache(dir string, maxSize int64) (*DiskCache, error) {
+	c := &DiskCache{
+		dir:     dir,
+		maxSize: maxSize,
+		entries: make(map[string]*diskEntry),
+		objects: make(map[string]int),
+		lru:     list.New(),
+	}
+	if err := os.MkdirAll(filepath.Join(dir, objectsDirName), 0700); err != nil {
+		return nil, err
+	}
+	// temporary files are leftovers of interrupted writes
+	if err := os.RemoveAll(filepath.Join(dir, tmpDirName)); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, tmpDirName), 0700); err != nil {
+		return nil, err
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	c.evict()
+	if err := c.compact(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *DiskCache) Get(key string) (*Entry, bool) {
+	c.mu.Lock()
+	e, found := c.entries[key]
+	if !found {
+		c.mu.Unlock()
+		return nil, false
+	}
+	e.lastAccess = time.Now()
+	c.lru.MoveToFront(e.element)
+	hash := e.hash
+	entry := &Entry{
+		ContentType:  e.contentType,
+		Expires:      e.expires,
+		ETag:         e.etag,
+		LastModified: e.lastModified,
+	}
+	c.mu.Unlock()
+
+	body, err := ioutil.ReadFile(c.objectPath(hash))
+	if err != nil || hashBody(body) != hash {
+		// the object was evicted in the meantime or is corrupted: the entry is deleted, unless a
+		// concurrent Set has replaced it with another body
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if e, found := c.entries[key]; found && e.hash == hash {
+			c.remove(e)
+			c.appendRecord(&record{Op: "del", Key: key})
+		}
+		return nil, false
+	}
+	entry.Body = body
+	return entry, true
+}
+
+func (c *DiskCache) Set(key string, entry *Entry) error {
+	size := int64(len(entry.Body))
+	if size > c.maxSize {
+		return ErrEntryTooLarge
+	}
+	hash := hashBody(entry.Body)
+
+	// the object is written and flushed without holding the lock, unless it is already stored
+	c.mu.Lock()
+	stored := c.objects[hash] > 0
+	c.mu.Unlock()
+	tmpPath := ""
+	if !stored {
+		var err error
+		if tmpPath, err = c.writeTemp(entry.Body); err != nil {
+			return err
+		}
+		defer func() {
+			if tmpPath != "" {
+				os.Remove(tmpPath)
+			}
+		}()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, found := c.entries[key]; found {
+		if old.hash == hash {
+			// same body, typically a revalidated entry: only the metadata changes
+			old.contentType = entry.ContentType
+			old.expires = entry.Expires
+			old.etag = entry.ETag
+			old.lastModified = entry.LastModified
+			old.lastAccess = time.Now()
+			c.lru.MoveToFront(old.element)
+			if err := c.appendRecord(old.record()); err != nil {
+				return err
+			}
+			return c.maybeCompact()
+		}
+		c.remove(old)
+	}
+	if c.objects[hash] == 0 {
+		var err error
+		if tmpPath != "" {
+			err = c.moveObject(tmpPath, hash)
+			tmpPath = ""
+		} else {
+			// the object was removed since it was found: it is written again, which is rare
+			err = c.writeObject(hash, entry.Body)
+		}
+		if err != nil {
+			c.appendRecord(&record{Op: "del", Key: key})
+			return err
+		}
+	}
+	e := &diskEntry{
+		key:          key,
+		hash:         hash,
+		size:         size,
+		contentType:  entry.ContentType,
+		expires:      entry.Expires,
+		etag:         entry.ETag,
+		lastModified: entry.LastModified,
+		lastAccess:   time.Now(),
+	}
+	c.add(e)
+	if err := c.appendRecord(e.record()); err != nil {
+		return err
+	}
+	c.evict()
+	return c.maybeCompact()
+}
+
+func (c *DiskCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, found := c.entries[key]
+	if !found {
+		return nil
+	}
+	c.remove(e)
+	return c.appendRecord(&record{Op: "del", Key: key})
+}
+
+// Close writes a compacted index and releases the journal.
+func (c *DiskCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.compact(); err != nil {
+		return err
+	}
+	err := c.journal.Close()
+	c.journal = nil
+	return err
+}
+
+// Size returns the total size of the stored bodies.
+func (c *DiskCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (e *diskEntry) record() *record {
+	return &record{
+		Op:           "set",
+		Key:          e.key,
+		Hash:         e.hash,
+		Size:         e.size,
+		ContentType:  e.contentType,
+		Expires:      e.expires,
+		ETag:         e.etag,
+		LastModified: e.lastModified,
+		LastAccess:   e.lastAccess,
+	}
+}
+
+// add and remove keep the entries, the LRU list, the object references and the total size in
+// sync. They don't write the journal.
+func (c *DiskCache) add(e *diskEntry) {
+	c.entries[e.key] = e
+	e.element = c.lru.PushFront(e)
+	if c.objects[e.hash] == 0 {
+		c.size += e.size
+	}
+	c.objects[e.hash]++
+}
+
+func (c *DiskCache) remove(e *diskEntry) {
+	delete(c.entries, e.key)
+	c.lru.Remove(e.element)
+	c.objects[e.hash]--
+	if c.objects[e.hash] <= 0 {
+		delete(c.objects, e.hash)
+		c.size -= e.size
+		os.Remove(c.objectPath(e.hash))
+	}
+}
+
+func (c *DiskCache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		e := c.lru.Back().Value.(*diskEntry)
+		c.remove(e)
+		c.appendRecord(&record{Op: "del", Key: e.key})
+	}
+}
+
+func (c *DiskCache) objectPath(hash string) string {
+	return filepath.Join(c.dir, objectsDirName, hash[:2], hash)
+}
+
+func (c *DiskCache) indexPath() string {
+	return filepath.Join(c.dir, indexFileName)
+}
+
+func (c *DiskCache) writeObject(hash string, body []byte) error {
+	path := c.objectPath(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return c.writeFileAtomic(path, body)
+}
+
+// moveObject moves a temporary file written by writeTemp to the object path of hash. The directory
+// is not flushed: an object lost in a crash is detected when the journal is loaded.
+func (c *DiskCache) moveObject(tmpPath, hash string) error {
+	path := c.objectPath(hash)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
+
+// writeFileAtomic writes data to a temporary file, flushes it to the disk and moves it to path.
+func (c *DiskCache) writeFileAtomic(path string, data []byte) error {
+	tmpPath, err := c.writeTemp(data)
+	if err != nil {
+		return err
+	}
+	return moveFile(tmpPath, path)
+}
+
+// writeTemp writes data to a temporary file, flushes it to the disk and returns its path.
+func (c *DiskCache) writeTemp(data []byte) (string, error) {
+	f, err := ioutil.TempFile(filepath.Join(c.dir, tmpDirName), "write")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// moveFile renames the temporary file tmpPath to path, or removes it on error.
+func moveFile(tmpPath, path string) error {
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+func (c *DiskCache) appendRecord(r *record) error {
+	if c.journal == nil {
+		return nil
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	c.journalRecords++
+	_, err = c.journal.Write(append(line, '\n'))
+	return err
+}
+
+func (c *DiskCache) maybeCompact() error {
+	if c.journalRecords > 2*len(c.entries)+100 {
+		return c.compact()
+	}
+	return nil
+}
+
+// compact replaces the journal with one record per entry, the least recently used first.
+func (c *DiskCache) compact() error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for element := c.lru.Back(); element != nil; element = element.Prev() {
+		if err := encoder.Encode(element.Value.(*diskEntry).record()); err != nil {
+			return err
+		}
+	}
+	if c.journal != nil {
+		c.journal.Close()
+		c.journal = nil
+	}
+	if err := c.writeFileAtomic(c.indexPath(), buf.Bytes()); err != nil {
+		return err
+	}
+	journal, err := os.OpenFile(c.indexPath(), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	c.journal = journal
+	c.journalRecords = c.lru.Len()
+	return nil
+}
+
+// load replays the journal, then drops the entries whose object is missing and the objects
+// without entry.
+func (c *DiskCache) load() error {
+	records := make(map[string]*record)
+	f, err := os.Open(c.indexPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var r record
+			if json.Unmarshal(scanner.Bytes(), &r) != nil {
+				// truncated line written during a crash
+				continue
+			}
+			switch r.Op {
+			case "set":
+				records[r.Key] = &r
+			case "del":
+				delete(records, r.Key)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	sorted := make([]*record, 0, len(records))
+	for _, r := range records {
+		if len(r.Hash) < 2 {
+			continue
+		}
+		info, err := os.Stat(c.objectPath(r.Hash))
+		if err != nil || info.Size() != r.Size {
+			continue
+		}
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].LastAccess.Before(sorted[j].LastAccess)
+	})
+	for _, r := range sorted {
+		c.add(&diskEntry{
+			key:          r.Key,
+			hash:         r.Hash,
+			size:         r.Size,
+			contentType:  r.ContentType,
+			expires:      r.Expires,
+			etag:         r.ETag,
+			lastModified: r.LastModified,
+			lastAccess:   r.LastAccess,
+		})
+	}
+
+	return filepath.Walk(filepath.Join(c.dir, objectsDirName), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && c.objects[info.Name()] == 0 {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+func hashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// syncDir flushes a directory entry, so a rename survives a crash. Not every platform supports
+// it, so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
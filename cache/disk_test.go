@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDiskCache(t *testing.T, maxSize int64) (*DiskCache, string) {
+	dir, err := ioutil.TempDir("", "morty-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewDiskCache(dir, maxSize)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return c, dir
+}
+
+func testEntry(body string) *Entry {
+	return &Entry{
+		ContentType: "text/css; charset=UTF-8",
+		Body:        []byte(body),
+		Expires:     time.Now().Add(time.Hour),
+	}
+}
+
+func checkEntry(t *testing.T, c Cache, key string, expectedBody string) {
+	entry, found := c.Get(key)
+	if expectedBody == "" {
+		if found {
+			t.Errorf(`Cache error. Key: "%s", Expected: miss, Got: "%s"`, key, entry.Body)
+		}
+		return
+	}
+	if !found {
+		t.Errorf(`Cache error. Key: "%s", Expected: "%s", Got: miss`, key, expectedBody)
+		return
+	}
+	if !bytes.Equal(entry.Body, []byte(expectedBody)) {
+		t.Errorf(`Cache error. Key: "%s", Expected: "%s", Got: "%s"`, key, expectedBody, entry.Body)
+	}
+	if entry.ContentType != "text/css; charset=UTF-8" {
+		t.Errorf(`Cache error. Key: "%s", unexpected content type: "%s"`, key, entry.ContentType)
+	}
+}
+
+func TestDiskCacheSetGet(t *testing.T) {
+	c, dir := newTestDiskCache(t, 1024)
+	defer os.RemoveAll(dir)
+
+	checkEntry(t, c, "a", "")
+	c.Set("a", testEntry("body a"))
+	c.Set("b", testEntry("body b"))
+	checkEntry(t, c, "a", "body a")
+	checkEntry(t, c, "b", "body b")
+
+	c.Set("a", testEntry("new body a"))
+	checkEntry(t, c, "a", "new body a")
+
+	c.Delete("b")
+	checkEntry(t, c, "b", "")
+
+	if c.Size() != int64(len("new body a")) {
+		t.Errorf("Unexpected cache size: %d", c.Size())
+	}
+}
+
+func TestDiskCacheSharedObject(t *testing.T) {
+	c, dir := newTestDiskCache(t, 1024)
+	defer os.RemoveAll(dir)
+
+	c.Set("a", testEntry("same body"))
+	c.Set("b", testEntry("same body"))
+	if c.Size() != int64(len("same body")) {
+		t.Errorf("Identical bodies must be stored once, size: %d", c.Size())
+	}
+	c.Delete("a")
+	checkEntry(t, c, "b", "same body")
+
+	c.Set("b", testEntry("same body"))
+	checkEntry(t, c, "b", "same body")
+}
+
+func TestDiskCacheConcurrentSetGet(t *testing.T) {
+	c, dir := newTestDiskCache(t, 1024)
+	defer os.RemoveAll(dir)
+
+	const count = 200
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if entry, found := c.Get("a"); found && !bytes.HasPrefix(entry.Body, []byte("body ")) {
+					t.Errorf("Unexpected body: %s", entry.Body)
+				}
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		if err := c.Set("a", testEntry(fmt.Sprintf("body %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	// a Get reading a replaced object mustn't delete the newer entry
+	checkEntry(t, c, "a", fmt.Sprintf("body %d", count-1))
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	c, dir := newTestDiskCache(t, 20)
+	defer os.RemoveAll(dir)
+
+	c.Set("a", testEntry("0123456789"))
+	c.Set("b", testEntry("abcdefghij"))
+	// "a" becomes the most recently used entry
+	checkEntry(t, c, "a", "0123456789")
+	c.Set("c", testEntry("ABCDEFGHIJ"))
+
+	checkEntry(t, c, "a", "0123456789")
+	checkEntry(t, c, "b", "")
+	checkEntry(t, c, "c", "ABCDEFGHIJ")
+
+	if err := c.Set("d", testEntry("this body is larger than the cache")); err != ErrEntryTooLarge {
+		t.Errorf("Expected ErrEntryTooLarge, got %v", err)
+	}
+}
+
+func TestDiskCacheReopen(t *testing.T) {
+	c, dir := newTestDiskCache(t, 1024)
+	defer os.RemoveAll(dir)
+
+	c.Set("a", testEntry("body a"))
+	c.Set("b", testEntry("body b"))
+	c.Delete("b")
+
+	// simulate a crash: a truncated journal line, an orphan object and a leftover temporary file
+	journal, _ := os.OpenFile(filepath.Join(dir, indexFileName), os.O_WRONLY|os.O_APPEND, 0600)
+	journal.Write([]byte(`{"op":"set","key":"c","ha`))
+	journal.Close()
+	orphan := c.objectPath(hashBody([]byte("orphan")))
+	os.MkdirAll(filepath.Dir(orphan), 0700)
+	ioutil.WriteFile(orphan, []byte("orphan"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, tmpDirName, "write123"), []byte("partial"), 0600)
+
+	c2, err := NewDiskCache(dir, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntry(t, c2, "a", "body a")
+	checkEntry(t, c2, "b", "")
+	checkEntry(t, c2, "c", "")
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("Orphan object was not removed")
+	}
+	if files, _ := ioutil.ReadDir(filepath.Join(dir, tmpDirName)); len(files) != 0 {
+		t.Errorf("Temporary files were not removed")
+	}
+	if err := c2.Close(); err != nil {
+		t.Error(err)
+	}
+}
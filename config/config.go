@@ -5,12 +5,34 @@ import (
 )
 
 type Config struct {
-	Debug          bool
-	ListenAddress  string
-	Key            string
-	IPV6           bool
-	RequestTimeout uint
-	FollowRedirect bool
+	Debug             bool
+	ListenAddress     string
+	Key               string
+	IPV6              bool
+	RequestTimeout    uint
+	FollowRedirect    bool
+	CacheDir          string
+	CacheSize         uint
+	CacheTTL          uint
+	RateLimit         float64
+	RateBurst         uint
+	MaxConcurrent     uint
+	MaxPerHost        uint
+	TrustedProxies    string
+	Compression       uint
+	HeaderProfile     string
+	HostProfiles      string
+	ForwardHeaders    string
+	CookieJar         bool
+	SessionTTL        uint
+	MaxSessions       uint
+	SessionSize       uint
+	AllowedMethods    string
+	IframeSandbox     string
+	IframeBlockHosts  string
+	AttributePolicy   string
+	ReaderOptOutHosts string
+	PDFSafeView       bool
 }
 
 var DefaultConfig *Config
@@ -22,11 +44,31 @@ func init() {
 	}
 	default_key := os.Getenv("MORTY_KEY")
 	DefaultConfig = &Config{
-		Debug:          os.Getenv("DEBUG") != "false",
-		ListenAddress:  default_listen_addr,
-		Key:            default_key,
-		IPV6:           true,
-		RequestTimeout: 5,
-		FollowRedirect: false,
+		Debug:           os.Getenv("DEBUG") != "false",
+		ListenAddress:   default_listen_addr,
+		Key:             default_key,
+		IPV6:            true,
+		RequestTimeout:  5,
+		FollowRedirect:  false,
+		CacheDir:        os.Getenv("MORTY_CACHE_DIR"),
+		CacheSize:       256,
+		CacheTTL:        3600,
+		RateLimit:       0,
+		RateBurst:       20,
+		MaxConcurrent:   0,
+		MaxPerHost:      0,
+		TrustedProxies:  os.Getenv("MORTY_TRUSTED_PROXIES"),
+		Compression:     6,
+		HeaderProfile:   "firefox-windows",
+		HostProfiles:    "",
+		ForwardHeaders:  "",
+		CookieJar:       false,
+		SessionTTL:      1800,
+		MaxSessions:     10000,
+		SessionSize:     64,
+		AllowedMethods:  "GET,HEAD,POST,PUT,PATCH,DELETE,OPTIONS",
+		IframeSandbox:   "strict",
+		AttributePolicy: os.Getenv("MORTY_ATTRIBUTE_POLICY"),
+		PDFSafeView:     false,
 	}
 }
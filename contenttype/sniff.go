@@ -0,0 +1,40 @@
+package contenttype
+
+import (
+	"net/http"
+)
+
+// SCRIPTABLE_FILTER lists the scriptable content types of the WHATWG MIME Sniffing standard: HTML,
+// XML and PDF documents may run scripts in the browsers.
+var SCRIPTABLE_FILTER Filter = NewFilterOr([]Filter{
+	NewFilterEquals("text", "html", ""),
+	NewFilterEquals("text", "xml", ""),
+	NewFilterEquals("application", "xml", ""),
+	NewFilterEquals("*", "*", "xml"),
+	NewFilterEquals("application", "pdf", ""),
+})
+
+// UNDEFINED_FILTER lists the content types handled like a missing Content-Type header: the
+// browsers sniff the type of these responses.
+var UNDEFINED_FILTER Filter = func(contenttype ContentType) bool {
+	if contenttype.Suffix != "" {
+		return false
+	}
+	switch contenttype.TopLevelType + "/" + contenttype.SubType {
+	case "unknown/unknown", "application/unknown", "*/*":
+		return true
+	}
+	return false
+}
+
+// Sniff returns the content type of data according to the WHATWG MIME Sniffing standard, as
+// computed for a response without Content-Type header. The first 512 bytes are read. The result
+// has no parameters: the charset of the text documents is determined from their content.
+func Sniff(data []byte) ContentType {
+	contenttype, err := ParseContentType(http.DetectContentType(data))
+	if err != nil {
+		return ContentType{"application", "octet-stream", "", map[string]string{}}
+	}
+	contenttype.Parameters = map[string]string{}
+	return contenttype
+}
@@ -0,0 +1,65 @@
+package contenttype
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+type SniffTestCase struct {
+	File         string
+	ExpectedType string
+	Scriptable   bool
+}
+
+// the files of testdata/polyglot are named after the content type they could be labeled with
+var sniffTestCases []SniffTestCase = []SniffTestCase{
+	SniffTestCase{"html-doctype.png", "text/html", true},
+	SniffTestCase{"html-whitespace.gif", "text/html", true},
+	SniffTestCase{"html-comment.jpg", "text/html", true},
+	SniffTestCase{"svg-xml.png", "text/xml", true},
+	SniffTestCase{"pdf.jpg", "application/pdf", true},
+	// the browsers show these files as images, fonts or archives
+	SniffTestCase{"gif-html.gif", "image/gif", false},
+	SniffTestCase{"png-html.png", "image/png", false},
+	SniffTestCase{"jpeg-html.jpg", "image/jpeg", false},
+	SniffTestCase{"woff-html.woff", "font/woff", false},
+	SniffTestCase{"zip-html.zip", "application/zip", false},
+	// texts
+	SniffTestCase{"bom-html.txt", "text/plain", false},
+	SniffTestCase{"tag-prefix.txt", "text/plain", false},
+	SniffTestCase{"text.txt", "text/plain", false},
+	SniffTestCase{"binary.bin", "application/octet-stream", false},
+}
+
+func TestSniff(t *testing.T) {
+	for _, testCase := range sniffTestCases {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "polyglot", testCase.File))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentType := Sniff(data)
+		if contentType.String() != testCase.ExpectedType {
+			t.Errorf(`Sniff error for "%s". Expected: %s, Got: %s`, testCase.File, testCase.ExpectedType, contentType.String())
+		}
+		if SCRIPTABLE_FILTER(contentType) != testCase.Scriptable {
+			t.Errorf(`Scriptable error for "%s". Expected: %t, Got: %t`, testCase.File, testCase.Scriptable, !testCase.Scriptable)
+		}
+	}
+	if contentType := Sniff(nil); contentType.String() != "text/plain" {
+		t.Errorf(`Sniff error for an empty document. Expected: text/plain, Got: %s`, contentType.String())
+	}
+}
+
+func TestUndefinedFilter(t *testing.T) {
+	for _, contentType := range []string{"unknown/unknown", "application/unknown", "*/*"} {
+		if c, _ := ParseContentType(contentType); !UNDEFINED_FILTER(c) {
+			t.Errorf(`Filter "UNDEFINED_FILTER" must accept the value "%s"`, contentType)
+		}
+	}
+	for _, contentType := range []string{"text/html", "application/octet-stream", "image/*", "*/*+xml"} {
+		if c, _ := ParseContentType(contentType); UNDEFINED_FILTER(c) {
+			t.Errorf(`Filter "UNDEFINED_FILTER" mustn't accept the value "%s"`, contentType)
+		}
+	}
+}
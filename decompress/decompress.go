@@ -0,0 +1,114 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ACCEPT_ENCODING is the Accept-Encoding header value matching the encodings Decode supports.
+const ACCEPT_ENCODING = "gzip, deflate, br"
+
+// Bodies decompressed to less than RATIO_THRESHOLD bytes are never considered as bombs, whatever
+// their compression ratio.
+const RATIO_THRESHOLD = 1024 * 1024
+
+var ErrTooLarge = errors.New("decompressed body is too large")
+var ErrRatio = errors.New("decompression ratio is too high")
+
+type UnsupportedEncodingError string
+
+func (e UnsupportedEncodingError) Error() string {
+	return fmt.Sprintf("unsupported content encoding: %s", string(e))
+}
+
+// Limits protects against decompression bombs.
+type Limits struct {
+	// MaxSize is the maximum size of the decompressed body.
+	MaxSize int
+	// MaxRatio is the maximum ratio between the decompressed size and the compressed size.
+	MaxRatio int
+}
+
+// Decode decompresses body according to a Content-Encoding header value. Encodings are listed in
+// the order they were applied, so they are removed in reverse order. An empty body, like the body
+// of a HEAD, 204 or 304 response, is returned unchanged.
+func Decode(contentEncoding []byte, body []byte, limits Limits) ([]byte, error) {
+	if len(body) == 0 {
+		return body, nil
+	}
+	encodings := strings.Split(string(contentEncoding), ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		var err error
+		switch encoding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			body, err = decode(body, limits, func(r io.Reader) (io.Reader, error) {
+				return gzip.NewReader(r)
+			})
+		case "deflate":
+			body, err = decode(body, limits, newDeflateReader)
+		case "br":
+			body, err = decode(body, limits, func(r io.Reader) (io.Reader, error) {
+				return brotli.NewReader(r), nil
+			})
+		default:
+			err = UnsupportedEncodingError(encoding)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// newDeflateReader reads "deflate" content: it should be zlib data, but some servers send raw
+// deflate data.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := r.(*bytes.Reader)
+	var header [2]byte
+	n, _ := br.ReadAt(header[:], 0)
+	if n == 2 && header[0]&0x0f == 8 && (uint(header[0])<<8|uint(header[1]))%31 == 0 {
+		return zlib.NewReader(r)
+	}
+	return flate.NewReader(r), nil
+}
+
+func decode(body []byte, limits Limits, newReader func(io.Reader) (io.Reader, error)) ([]byte, error) {
+	r, err := newReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	lr := &limitedReader{r: r, compressedSize: len(body), limits: limits}
+	return ioutil.ReadAll(lr)
+}
+
+// limitedReader fails as soon as the limits are exceeded, without decompressing the whole bomb.
+type limitedReader struct {
+	r              io.Reader
+	n              int
+	compressedSize int
+	limits         Limits
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.n += n
+	if lr.limits.MaxSize > 0 && lr.n > lr.limits.MaxSize {
+		return n, ErrTooLarge
+	}
+	if lr.limits.MaxRatio > 0 && lr.n > RATIO_THRESHOLD && lr.n > lr.compressedSize*lr.limits.MaxRatio {
+		return n, ErrRatio
+	}
+	return n, err
+}
@@ -0,0 +1,100 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+var testBody []byte = bytes.Repeat([]byte("<p>morty</p>\n"), 100)
+
+func gzipBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func zlibBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func flateBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func brotliBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	w := brotli.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+type DecodeTestCase struct {
+	ContentEncoding string
+	Input           []byte
+}
+
+var decodeTestData []*DecodeTestCase = []*DecodeTestCase{
+	&DecodeTestCase{"", testBody},
+	&DecodeTestCase{"identity", testBody},
+	&DecodeTestCase{"gzip", gzipBytes(testBody)},
+	&DecodeTestCase{"X-GZIP", gzipBytes(testBody)},
+	&DecodeTestCase{"deflate", zlibBytes(testBody)},
+	&DecodeTestCase{"deflate", flateBytes(testBody)},
+	&DecodeTestCase{"br", brotliBytes(testBody)},
+	&DecodeTestCase{"gzip, br", brotliBytes(gzipBytes(testBody))},
+}
+
+func TestDecode(t *testing.T) {
+	limits := Limits{MaxSize: 10 * 1024 * 1024, MaxRatio: 100}
+	for _, testCase := range decodeTestData {
+		output, err := Decode([]byte(testCase.ContentEncoding), testCase.Input, limits)
+		if err != nil {
+			t.Errorf(`Decode error. Content-Encoding: "%s", Error: %s`, testCase.ContentEncoding, err)
+			continue
+		}
+		if !bytes.Equal(output, testBody) {
+			t.Errorf(`Decode error. Content-Encoding: "%s", Got: "%s"`, testCase.ContentEncoding, output)
+		}
+	}
+}
+
+func TestDecodeEmpty(t *testing.T) {
+	for _, contentEncoding := range []string{"gzip", "deflate", "br", "gzip, br"} {
+		if output, err := Decode([]byte(contentEncoding), []byte{}, Limits{}); err != nil || len(output) != 0 {
+			t.Errorf(`Decode error for an empty body. Content-Encoding: "%s", Got: "%s", %v`, contentEncoding, output, err)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	bomb := gzipBytes(make([]byte, 4*1024*1024))
+
+	if _, err := Decode([]byte("gzip"), bomb, Limits{MaxSize: 10 * 1024 * 1024, MaxRatio: 100}); err != ErrRatio {
+		t.Errorf("Expected ErrRatio, got %v", err)
+	}
+	if _, err := Decode([]byte("gzip"), bomb, Limits{MaxSize: 1024 * 1024}); err != ErrTooLarge {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+	if _, err := Decode([]byte("compress"), testBody, Limits{}); err != UnsupportedEncodingError("compress") {
+		t.Errorf("Expected UnsupportedEncodingError, got %v", err)
+	}
+	if _, err := Decode([]byte("gzip"), testBody, Limits{}); err == nil {
+		t.Errorf("Decoding an invalid gzip body must fail")
+	}
+}
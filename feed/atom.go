@@ -0,0 +1,120 @@
+package feed
+
+import (
+	"encoding/xml"
+
+	"github.com/asciimoo/morty/sanitizer"
+)
+
+type atomFeed struct {
+	XMLName  xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    *atomText    `xml:"title"`
+	Subtitle *atomText    `xml:"subtitle"`
+	ID       string       `xml:"id,omitempty"`
+	Updated  string       `xml:"updated,omitempty"`
+	Links    []atomLink   `xml:"link"`
+	Authors  []atomPerson `xml:"author"`
+	Icon     string       `xml:"icon,omitempty"`
+	Logo     string       `xml:"logo,omitempty"`
+	Rights   *atomText    `xml:"rights"`
+	Entries  []atomEntry  `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title      *atomText      `xml:"title"`
+	ID         string         `xml:"id,omitempty"`
+	Updated    string         `xml:"updated,omitempty"`
+	Published  string         `xml:"published,omitempty"`
+	Links      []atomLink     `xml:"link"`
+	Authors    []atomPerson   `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary"`
+	Content    *atomText      `xml:"content"`
+}
+
+// atomText is a text construct, or a content element when Src is set. InnerXML is read to
+// sanitize the XHTML texts, and it is always cleared before the feed is written: the encoder writes
+// it as is.
+type atomText struct {
+	Type     string `xml:"type,attr,omitempty"`
+	Src      string `xml:"src,attr,omitempty"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length string `xml:"length,attr,omitempty"`
+	Title  string `xml:"title,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name  string `xml:"name"`
+	URI   string `xml:"uri,omitempty"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+func (f *atomFeed) sanitize(s *sanitizer.Sanitizer) {
+	f.Title = sanitizeAtomText(s, f.Title)
+	f.Subtitle = sanitizeAtomText(s, f.Subtitle)
+	f.Rights = sanitizeAtomText(s, f.Rights)
+	f.Links = sanitizeAtomLinks(s, f.Links)
+	f.Authors = sanitizeAtomPersons(s, f.Authors)
+	f.Icon = rewriteURL(s, f.Icon)
+	f.Logo = rewriteURL(s, f.Logo)
+	for i := range f.Entries {
+		e := &f.Entries[i]
+		e.Title = sanitizeAtomText(s, e.Title)
+		e.Links = sanitizeAtomLinks(s, e.Links)
+		e.Authors = sanitizeAtomPersons(s, e.Authors)
+		e.Summary = sanitizeAtomText(s, e.Summary)
+		e.Content = sanitizeAtomText(s, e.Content)
+	}
+}
+
+// sanitizeAtomText returns the text as plain text or sanitized HTML. The contents of other types
+// are removed, unless they are out of line.
+func sanitizeAtomText(s *sanitizer.Sanitizer, t *atomText) *atomText {
+	if t == nil {
+		return nil
+	}
+	if t.Src != "" {
+		if src := rewriteURL(s, t.Src); src != "" {
+			return &atomText{Type: t.Type, Src: src}
+		}
+		return nil
+	}
+	switch t.Type {
+	case "", "text", "text/plain":
+		return &atomText{Type: t.Type, Text: t.Text}
+	case "html", "text/html":
+		return &atomText{Type: "html", Text: sanitizeHTML(s, t.Text)}
+	case "xhtml", "application/xhtml+xml":
+		return &atomText{Type: "html", Text: sanitizeHTML(s, t.InnerXML)}
+	}
+	return nil
+}
+
+func sanitizeAtomLinks(s *sanitizer.Sanitizer, links []atomLink) []atomLink {
+	sanitized := links[:0]
+	for _, link := range links {
+		if link.Href = rewriteURL(s, link.Href); link.Href != "" {
+			sanitized = append(sanitized, link)
+		}
+	}
+	return sanitized
+}
+
+func sanitizeAtomPersons(s *sanitizer.Sanitizer, persons []atomPerson) []atomPerson {
+	for i := range persons {
+		persons[i].URI = rewriteURL(s, persons[i].URI)
+	}
+	return persons
+}
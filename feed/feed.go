@@ -0,0 +1,118 @@
+// Package feed sanitizes RSS 2.0 and Atom feeds. A feed is parsed and written again with its known
+// elements only: the HTML of the descriptions and the contents is sanitized, and the URLs of the
+// links, the enclosures and the images are rewritten, so feed readers can subscribe through the
+// proxy.
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+
+	"github.com/asciimoo/morty/sanitizer"
+)
+
+const ATOM_NAMESPACE = "http://www.w3.org/2005/Atom"
+
+// ErrUnknownFeed is returned when the document is neither a RSS 2.0 nor an Atom feed.
+var ErrUnknownFeed = errors.New("unknown feed format")
+
+// Sanitize parses the RSS 2.0 or Atom feed read from r, and writes it to w as UTF-8. The HTML of
+// the feed is sanitized by s, and its URLs are rewritten by s, so s should have no head and body
+// extensions. Nothing is written if the feed is invalid.
+func Sanitize(w io.Writer, r io.Reader, s *sanitizer.Sanitizer) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	root, err := rootElement(body)
+	if err != nil {
+		return err
+	}
+
+	var f interface{}
+	switch {
+	case root.Local == "rss":
+		rss := &rssFeed{}
+		if err := newDecoder(body).Decode(rss); err != nil {
+			return err
+		}
+		rss.sanitize(s)
+		f = rss
+	case root.Local == "feed" && root.Space == ATOM_NAMESPACE:
+		atom := &atomFeed{}
+		if err := newDecoder(body).Decode(atom); err != nil {
+			return err
+		}
+		atom.sanitize(s)
+		f = atom
+	default:
+		return ErrUnknownFeed
+	}
+
+	out := bytes.NewBuffer(nil)
+	out.WriteString(xml.Header)
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+	out.WriteString("\n")
+	_, err = out.WriteTo(w)
+	return err
+}
+
+// newDecoder returns a strict decoder of body, which converts the declared charset to UTF-8. The
+// entities declared by a DTD are not expanded.
+func newDecoder(body []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.CharsetReader = charset.NewReaderLabel
+	return d
+}
+
+func rootElement(body []byte) (xml.Name, error) {
+	d := newDecoder(body)
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return xml.Name{}, ErrUnknownFeed
+		}
+		if err != nil {
+			return xml.Name{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// sanitizeHTML returns the sanitized fragment, or an empty string if the fragment is invalid.
+func sanitizeHTML(s *sanitizer.Sanitizer, fragment string) string {
+	if fragment == "" {
+		return ""
+	}
+	out := bytes.NewBuffer(nil)
+	if err := s.HTML(out, strings.NewReader(fragment)); err != nil {
+		return ""
+	}
+	return out.String()
+}
+
+// rewriteURL returns the rewritten URL of uri, or an empty string if the URL is unsafe. The URL of
+// the feed itself is rewritten too: the feed is not the document its readers link from.
+func rewriteURL(s *sanitizer.Sanitizer, uri string) string {
+	uri = strings.TrimSpace(uri)
+	if uri == "" {
+		return ""
+	}
+	rewritten, err := s.ExternalURL(uri)
+	if err != nil {
+		return ""
+	}
+	return rewritten
+}
@@ -0,0 +1,152 @@
+package feed
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/asciimoo/morty/sanitizer"
+)
+
+var RSS_FEED string = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<?xml-stylesheet type="text/xsl" href="feed.xsl"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+<channel>
+ <title>Example news</title>
+ <link>https://example.com/</link>
+ <atom:link href="https://example.com/feed.xml" rel="self" type="application/rss+xml"/>
+ <description>The &lt;b&gt;news&lt;/b&gt;</description>
+ <image><url>/logo.png</url><title>Example</title><link>https://example.com/</link></image>
+ <item>
+  <title>Caf` + "\xe9" + ` &amp; more</title>
+  <link>/news/1</link>
+  <description>&lt;p onclick="x()"&gt;Text &lt;a href="javascript:x()"&gt;link&lt;/a&gt;&lt;/p&gt;&lt;script&gt;x()&lt;/script&gt;</description>
+  <content:encoded><![CDATA[<img src="/a.png"><iframe src="https://evil.example.org/"></iframe>]]></content:encoded>
+  <enclosure url="https://cdn.example.com/1.mp3" length="42" type="audio/mpeg"/>
+  <enclosure url="javascript:x()" type="audio/mpeg"/>
+  <guid>https://example.com/news/1</guid>
+  <pubDate>Sun, 18 Oct 2026 10:00:00 GMT</pubDate>
+  <dc:unknown xmlns:dc="http://purl.org/dc/elements/1.1/">removed</dc:unknown>
+ </item>
+ <item>
+  <title>Second</title>
+  <guid isPermaLink="false">tag:example.com,2026:2</guid>
+ </item>
+</channel>
+</rss>`
+
+var ATOM_FEED string = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+ <title type="html">Example &lt;i&gt;blog&lt;/i&gt;</title>
+ <id>tag:example.com,2026:blog</id>
+ <link href="https://example.com/blog/" />
+ <link rel="self" href="https://example.com/atom.xml" />
+ <author><name>Jane</name><uri>javascript:x()</uri></author>
+ <entry>
+  <title>First</title>
+  <id>tag:example.com,2026:1</id>
+  <updated>2026-10-18T10:00:00Z</updated>
+  <link rel="alternate" href="/blog/1" />
+  <link rel="enclosure" href="data:text/html,x" />
+  <summary type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Summary <b onmouseover="x()">bold</b></p><script>x()</script></div></summary>
+  <content type="image/svg+xml"><svg xmlns="http://www.w3.org/2000/svg"><script>x()</script></svg></content>
+ </entry>
+ <entry>
+  <title>Second</title>
+  <content type="video/mp4" src="https://cdn.example.com/2.mp4" />
+ </entry>
+</feed>`
+
+var sanitizedFeedTestData []*StringTestCase = []*StringTestCase{
+	&StringTestCase{RSS_FEED, `<rss version="2.0">`},
+	&StringTestCase{RSS_FEED, `<link>./?mortyurl=https%3A%2F%2Fexample.com%2F</link>`},
+	&StringTestCase{RSS_FEED, `<description>The &lt;b&gt;news&lt;/b&gt;</description>`},
+	&StringTestCase{RSS_FEED, `<url>./?mortyurl=https%3A%2F%2Fexample.com%2Flogo.png</url>`},
+	&StringTestCase{RSS_FEED, `<title>Café &amp; more</title>`},
+	&StringTestCase{RSS_FEED, `<link>./?mortyurl=https%3A%2F%2Fexample.com%2Fnews%2F1</link>`},
+	&StringTestCase{RSS_FEED, `<description>&lt;p&gt;Text &lt;a href=&#34;&#34;&gt;link&lt;/a&gt;&lt;/p&gt;</description>`},
+	&StringTestCase{RSS_FEED, `&lt;img src=&#34;./?mortyurl=https%3A%2F%2Fexample.com%2Fa.png&#34;&gt;&lt;iframe src=&#34;./?mortyurl=https%3A%2F%2Fevil.example.org%2F&#34; sandbox=&#34;&#34;&gt;&lt;/iframe&gt;</encoded>`},
+	&StringTestCase{RSS_FEED, `<enclosure url="./?mortyurl=https%3A%2F%2Fcdn.example.com%2F1.mp3" length="42" type="audio/mpeg"></enclosure>`},
+	&StringTestCase{RSS_FEED, `<guid>./?mortyurl=https%3A%2F%2Fexample.com%2Fnews%2F1</guid>`},
+	&StringTestCase{RSS_FEED, `<guid isPermaLink="false">tag:example.com,2026:2</guid>`},
+	&StringTestCase{ATOM_FEED, `<feed xmlns="http://www.w3.org/2005/Atom">`},
+	&StringTestCase{ATOM_FEED, `<title type="html">Example &lt;i&gt;blog&lt;/i&gt;</title>`},
+	&StringTestCase{ATOM_FEED, `<link href="./?mortyurl=https%3A%2F%2Fexample.com%2Fatom.xml" rel="self"></link>`},
+	&StringTestCase{ATOM_FEED, `<author>` + "\n" + `    <name>Jane</name>` + "\n" + `  </author>`},
+	&StringTestCase{ATOM_FEED, `<link href="./?mortyurl=https%3A%2F%2Fexample.com%2Fblog%2F1" rel="alternate"></link>`},
+	&StringTestCase{ATOM_FEED, `&lt;p&gt;Summary &lt;b&gt;bold&lt;/b&gt;&lt;/p&gt;`},
+	&StringTestCase{ATOM_FEED, `<content type="video/mp4" src="./?mortyurl=https%3A%2F%2Fcdn.example.com%2F2.mp4"></content>`},
+}
+
+var unsafeFeedTestData []*StringTestCase = []*StringTestCase{
+	&StringTestCase{RSS_FEED, "xml-stylesheet"},
+	&StringTestCase{RSS_FEED, "feed.xml"},
+	&StringTestCase{RSS_FEED, "x()"},
+	&StringTestCase{RSS_FEED, "javascript"},
+	&StringTestCase{RSS_FEED, "removed"},
+	&StringTestCase{ATOM_FEED, "x()"},
+	&StringTestCase{ATOM_FEED, "svg"},
+	&StringTestCase{ATOM_FEED, "javascript"},
+	&StringTestCase{ATOM_FEED, "data:"},
+	&StringTestCase{ATOM_FEED, "onmouseover"},
+}
+
+type StringTestCase struct {
+	Input          string
+	ExpectedOutput string
+}
+
+func sanitizeFeed(t *testing.T, feed string) string {
+	u, _ := url.Parse("https://example.com/feed.xml")
+	s := sanitizer.New(u, &sanitizer.ProxyRewriter{})
+	out := bytes.NewBuffer(nil)
+	if err := Sanitize(out, strings.NewReader(feed), s); err != nil {
+		t.Fatalf("Feed error: %v", err)
+	}
+	return out.String()
+}
+
+func TestSanitize(t *testing.T) {
+	for _, testCase := range sanitizedFeedTestData {
+		if out := sanitizeFeed(t, testCase.Input); !strings.Contains(out, testCase.ExpectedOutput) {
+			t.Errorf("Feed error. Expected: %s, Got: %s", testCase.ExpectedOutput, out)
+		}
+	}
+	for _, testCase := range unsafeFeedTestData {
+		if out := sanitizeFeed(t, testCase.Input); strings.Contains(out, testCase.ExpectedOutput) {
+			t.Errorf("Unsafe feed. Unexpected: %s, Got: %s", testCase.ExpectedOutput, out)
+		}
+	}
+}
+
+func TestSanitizeSelfLink(t *testing.T) {
+	// the feed is fetched from its self link
+	u, _ := url.Parse("https://example.com/atom.xml")
+	s := sanitizer.New(u, &sanitizer.ProxyRewriter{})
+	out := bytes.NewBuffer(nil)
+	if err := Sanitize(out, strings.NewReader(ATOM_FEED), s); err != nil {
+		t.Fatalf("Feed error: %v", err)
+	}
+	expected := `<link href="./?mortyurl=https%3A%2F%2Fexample.com%2Fatom.xml" rel="self"></link>`
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("Feed self link error. Expected: %s, Got: %s", expected, out)
+	}
+}
+
+func TestSanitizeInvalid(t *testing.T) {
+	u, _ := url.Parse("https://example.com/feed.xml")
+	s := sanitizer.New(u, nil)
+	for _, doc := range []string{
+		``,
+		`<html><body>not a feed</body></html>`,
+		`<feed><title>Atom without namespace</title></feed>`,
+		`<rss version="2.0"><channel><title>Unclosed</channel></rss>`,
+		`<!DOCTYPE rss [<!ENTITY x "expanded">]><rss version="2.0"><channel><title>&x;</title></channel></rss>`,
+	} {
+		out := bytes.NewBuffer(nil)
+		if err := Sanitize(out, strings.NewReader(doc), s); err == nil || out.Len() > 0 {
+			t.Errorf("Invalid feed error. Feed: %s, Got: %s", doc, out)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package feed
+
+import (
+	"encoding/xml"
+
+	"github.com/asciimoo/morty/sanitizer"
+)
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title,omitempty"`
+	Links         []rssLink `xml:"link"`
+	Description   string    `xml:"description,omitempty"`
+	Language      string    `xml:"language,omitempty"`
+	Copyright     string    `xml:"copyright,omitempty"`
+	PubDate       string    `xml:"pubDate,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	TTL           string    `xml:"ttl,omitempty"`
+	Image         *rssImage `xml:"image"`
+	Items         []rssItem `xml:"item"`
+}
+
+// rssLink matches the <atom:link> elements too, they are removed.
+type rssLink struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title,omitempty"`
+	Link  string `xml:"link,omitempty"`
+}
+
+type rssItem struct {
+	Title       string         `xml:"title,omitempty"`
+	Links       []rssLink      `xml:"link"`
+	Description string         `xml:"description,omitempty"`
+	Content     string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded,omitempty"`
+	Author      string         `xml:"author,omitempty"`
+	Categories  []string       `xml:"category"`
+	Comments    string         `xml:"comments,omitempty"`
+	Enclosures  []rssEnclosure `xml:"enclosure"`
+	GUID        *rssGUID       `xml:"guid"`
+	PubDate     string         `xml:"pubDate,omitempty"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr,omitempty"`
+	Value       string `xml:",chardata"`
+}
+
+func (f *rssFeed) sanitize(s *sanitizer.Sanitizer) {
+	f.Version = "2.0"
+	c := &f.Channel
+	c.Links = sanitizeRSSLinks(s, c.Links)
+	c.Description = sanitizeHTML(s, c.Description)
+	if c.Image != nil {
+		c.Image.URL = rewriteURL(s, c.Image.URL)
+		c.Image.Link = rewriteURL(s, c.Image.Link)
+		if c.Image.URL == "" {
+			c.Image = nil
+		}
+	}
+	for i := range c.Items {
+		item := &c.Items[i]
+		item.Links = sanitizeRSSLinks(s, item.Links)
+		item.Description = sanitizeHTML(s, item.Description)
+		item.Content = sanitizeHTML(s, item.Content)
+		item.Comments = rewriteURL(s, item.Comments)
+		enclosures := item.Enclosures[:0]
+		for _, e := range item.Enclosures {
+			if e.URL = rewriteURL(s, e.URL); e.URL != "" {
+				enclosures = append(enclosures, e)
+			}
+		}
+		item.Enclosures = enclosures
+		// the GUID is a link, unless isPermaLink is false
+		if item.GUID != nil && item.GUID.IsPermaLink != "false" {
+			if item.GUID.Value = rewriteURL(s, item.GUID.Value); item.GUID.Value == "" {
+				item.GUID = nil
+			}
+		}
+	}
+}
+
+// sanitizeRSSLinks keeps the first RSS link.
+func sanitizeRSSLinks(s *sanitizer.Sanitizer, links []rssLink) []rssLink {
+	for _, link := range links {
+		if link.XMLName.Space != "" {
+			continue
+		}
+		if uri := rewriteURL(s, link.Value); uri != "" {
+			return []rssLink{{XMLName: xml.Name{Local: "link"}, Value: uri}}
+		}
+	}
+	return nil
+}
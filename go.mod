@@ -3,6 +3,7 @@ module github.com/asciimoo/morty
 go 1.14
 
 require (
+	github.com/andybalholm/brotli v1.0.0
 	github.com/valyala/fasthttp v1.21.0
 	golang.org/x/net v0.0.0-20201016165138-7b1cca2348c0
 	golang.org/x/text v0.3.3
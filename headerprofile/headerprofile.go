@@ -0,0 +1,179 @@
+package headerprofile
+
+import (
+	"fmt"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Profile is a set of request headers sent upstream, mimicking a common browser.
+type Profile struct {
+	UserAgent      string
+	Accept         string
+	AcceptLanguage string
+}
+
+const DEFAULT_PROFILE = "firefox-windows"
+
+const firefoxAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"
+const chromeAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8"
+
+var PROFILES map[string]*Profile = map[string]*Profile{
+	"firefox-windows": &Profile{
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0",
+		Accept:         firefoxAccept,
+		AcceptLanguage: "en-US,en;q=0.5",
+	},
+	"firefox-linux": &Profile{
+		UserAgent:      "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0",
+		Accept:         firefoxAccept,
+		AcceptLanguage: "en-US,en;q=0.5",
+	},
+	"firefox-android": &Profile{
+		UserAgent:      "Mozilla/5.0 (Android 14; Mobile; rv:128.0) Gecko/128.0 Firefox/128.0",
+		Accept:         firefoxAccept,
+		AcceptLanguage: "en-US,en;q=0.5",
+	},
+	"chrome-windows": &Profile{
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+		Accept:         chromeAccept,
+		AcceptLanguage: "en-US,en;q=0.9",
+	},
+	"chrome-android": &Profile{
+		UserAgent:      "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36",
+		Accept:         chromeAccept,
+		AcceptLanguage: "en-US,en;q=0.9",
+	},
+}
+
+// FORWARDABLE_HEADERS are the only client headers which can be forwarded upstream: they don't
+// identify the client more than its language does.
+var FORWARDABLE_HEADERS map[string]bool = map[string]bool{
+	"Accept-Language": true,
+	"Dnt":             true,
+	"Sec-Gpc":         true,
+}
+
+// forwarded values are short and restricted to the characters of the forwardable headers
+const maxForwardedValueLength = 128
+
+// Selector chooses the profile of an upstream request, globally or per host, and forwards the
+// whitelisted client headers.
+type Selector struct {
+	Default *Profile
+	// Hosts maps a host to a profile, the profile applies to the subdomains too.
+	Hosts map[string]*Profile
+	// Forward lists the canonical names of the client headers to forward.
+	Forward []string
+}
+
+// NewSelector builds a Selector from the profile name, a comma separated list of host=profile
+// pairs and a comma separated list of client headers.
+func NewSelector(defaultProfile, hostProfiles, forwardHeaders string) (*Selector, error) {
+	s := &Selector{Hosts: make(map[string]*Profile)}
+
+	var err error
+	if s.Default, err = getProfile(defaultProfile); err != nil {
+		return nil, err
+	}
+
+	for _, item := range splitList(hostProfiles) {
+		pair := strings.SplitN(item, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid host profile: %s", item)
+		}
+		profile, err := getProfile(strings.TrimSpace(pair[1]))
+		if err != nil {
+			return nil, err
+		}
+		s.Hosts[strings.ToLower(strings.TrimSpace(pair[0]))] = profile
+	}
+
+	for _, name := range splitList(forwardHeaders) {
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		if !FORWARDABLE_HEADERS[name] {
+			return nil, fmt.Errorf("header can't be forwarded: %s", name)
+		}
+		s.Forward = append(s.Forward, name)
+	}
+
+	return s, nil
+}
+
+// Profile returns the profile to use for host.
+func (s *Selector) Profile(host string) *Profile {
+	host = strings.ToLower(host)
+	for {
+		if profile, found := s.Hosts[host]; found {
+			return profile
+		}
+		dot := strings.IndexByte(host, '.')
+		if dot == -1 {
+			return s.Default
+		}
+		host = host[dot+1:]
+	}
+}
+
+// Apply sets the headers of the upstream request to host. The client headers are only read for
+// the whitelisted ones. A nil Selector applies the default profile.
+func (s *Selector) Apply(host string, client, upstream *fasthttp.RequestHeader) {
+	if s == nil {
+		s = &Selector{Default: PROFILES[DEFAULT_PROFILE]}
+	}
+	profile := s.Profile(host)
+	upstream.SetUserAgent(profile.UserAgent)
+	upstream.Set("Accept", profile.Accept)
+	upstream.Set("Accept-Language", profile.AcceptLanguage)
+	for _, name := range s.Forward {
+		if value := client.Peek(name); len(value) > 0 && isSafeValue(value) {
+			upstream.SetBytesV(name, value)
+		}
+	}
+}
+
+// Names returns the sorted list of the profile names.
+func Names() []string {
+	names := make([]string, 0, len(PROFILES))
+	for name := range PROFILES {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getProfile(name string) (*Profile, error) {
+	if name == "" {
+		name = DEFAULT_PROFILE
+	}
+	profile, found := PROFILES[name]
+	if !found {
+		return nil, fmt.Errorf("unknown header profile: %s (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return profile, nil
+}
+
+func isSafeValue(value []byte) bool {
+	if len(value) > maxForwardedValueLength {
+		return false
+	}
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte(",;=.-* ", c) != -1) {
+			return false
+		}
+	}
+	return true
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
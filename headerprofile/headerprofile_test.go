@@ -0,0 +1,84 @@
+package headerprofile
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+type ProfileTestCase struct {
+	Host            string
+	ExpectedProfile string
+}
+
+var profileTestData []*ProfileTestCase = []*ProfileTestCase{
+	&ProfileTestCase{"example.com", "chrome-android"},
+	&ProfileTestCase{"www.EXAMPLE.com", "chrome-android"},
+	&ProfileTestCase{"notexample.com", "firefox-linux"},
+	&ProfileTestCase{"a.b.example.org", "firefox-windows"},
+	&ProfileTestCase{"example.org", "firefox-linux"},
+	&ProfileTestCase{"localhost", "firefox-linux"},
+}
+
+func TestSelectorProfile(t *testing.T) {
+	s, err := NewSelector("firefox-linux", "example.com=chrome-android, b.example.org = firefox-windows", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range profileTestData {
+		if profile := s.Profile(testCase.Host); profile != PROFILES[testCase.ExpectedProfile] {
+			t.Errorf(`Profile error. Host: "%s", Expected: "%s", Got: "%s"`, testCase.Host, testCase.ExpectedProfile, profile.UserAgent)
+		}
+	}
+}
+
+func TestSelectorApply(t *testing.T) {
+	s, err := NewSelector("", "", "accept-language, DNT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var client, upstream fasthttp.RequestHeader
+	client.Set("Accept-Language", "fr-FR,fr;q=0.8")
+	client.Set("DNT", "1")
+	client.Set("Cookie", "session=secret")
+	client.SetUserAgent("client user agent")
+	s.Apply("example.com", &client, &upstream)
+
+	expected := map[string]string{
+		"User-Agent":      PROFILES[DEFAULT_PROFILE].UserAgent,
+		"Accept":          PROFILES[DEFAULT_PROFILE].Accept,
+		"Accept-Language": "fr-FR,fr;q=0.8",
+		"Dnt":             "1",
+		"Cookie":          "",
+	}
+	for name, value := range expected {
+		if string(upstream.Peek(name)) != value {
+			t.Errorf(`Header error. Name: "%s", Expected: "%s", Got: "%s"`, name, value, upstream.Peek(name))
+		}
+	}
+
+	// values with unexpected characters are replaced by the profile value
+	client.Set("Accept-Language", "fr\"<script>")
+	upstream.Reset()
+	s.Apply("example.com", &client, &upstream)
+	if string(upstream.Peek("Accept-Language")) != PROFILES[DEFAULT_PROFILE].AcceptLanguage {
+		t.Errorf(`Unsafe Accept-Language forwarded: "%s"`, upstream.Peek("Accept-Language"))
+	}
+}
+
+var invalidSelectorTestData [][]string = [][]string{
+	[]string{"unknown", "", ""},
+	[]string{"", "example.com", ""},
+	[]string{"", "example.com=unknown", ""},
+	[]string{"", "", "User-Agent"},
+	[]string{"", "", "Cookie"},
+	[]string{"", "", "X-Forwarded-For"},
+}
+
+func TestNewSelectorErrors(t *testing.T) {
+	for _, testCase := range invalidSelectorTestData {
+		if _, err := NewSelector(testCase[0], testCase[1], testCase[2]); err == nil {
+			t.Errorf("Expected an error for %q", testCase)
+		}
+	}
+}
@@ -1,227 +1,1214 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/valyala/fasthttp"
+
+	"github.com/asciimoo/morty/cache"
+	"github.com/asciimoo/morty/ratelimit"
+	"github.com/asciimoo/morty/sanitizer"
+	"github.com/asciimoo/morty/session"
 )
 
-type AttrTestCase struct {
-	AttrName       []byte
-	AttrValue      []byte
-	ExpectedOutput []byte
+func TestHostInList(t *testing.T) {
+	hosts := parseHosts("example.com, Ads.Example.org")
+	for host, expected := range map[string]bool{
+		"example.com":       true,
+		"www.example.com":   true,
+		"x.ads.example.org": true,
+		"example.org":       false,
+		"notexample.com":    false,
+	} {
+		if hostInList(host, hosts) != expected {
+			t.Errorf(`Host list error. Host: "%s", Expected: %v`, host, expected)
+		}
+	}
 }
 
-type SanitizeURITestCase struct {
-	Input          []byte
-	ExpectedOutput []byte
-	ExpectedScheme string
+func TestFormActionOverride(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%s?%s", r.URL.Path, r.URL.RawQuery)
+	}))
+	defer server.Close()
+
+	p := &Proxy{RequestTimeout: 5 * time.Second}
+	prefix := sanitizer.SUBMITTER_PREFIX + url.Values{"mortyurl": {server.URL + "/button"}}.Encode() + ":"
+	for _, testCase := range []struct {
+		Input          string
+		ExpectedOutput string
+	}{
+		// button without name
+		{"q=morty&" + url.QueryEscape(prefix) + "=", "/button?q=morty"},
+		// named submit input
+		{"q=morty&" + url.QueryEscape(prefix+"go") + "=Search", "/button?q=morty&go=Search"},
+		// image inputs
+		{"q=morty&" + url.QueryEscape(prefix+".x") + "=1&" + url.QueryEscape(prefix+".y") + "=2", "/button?q=morty&x=1&y=2"},
+		{url.QueryEscape(prefix+"img.x") + "=1&" + url.QueryEscape(prefix+"img.y") + "=2", "/button?img.x=1&img.y=2"},
+	} {
+		ctx := newTestRequestCtx("GET")
+		ctx.Request.SetRequestURI("/?mortydownload=1&mortyurl=" + url.QueryEscape(server.URL+"/form") + "&" + testCase.Input)
+		p.RequestHandler(ctx)
+		if string(ctx.Response.Body()) != testCase.ExpectedOutput {
+			t.Errorf(`Form action override error. Expected: "%s", Got: "%s"`, testCase.ExpectedOutput, ctx.Response.Body())
+		}
+	}
 }
 
-type StringTestCase struct {
-	Input          string
-	ExpectedOutput string
+type memoryCache struct {
+	sync.Mutex
+	entries map[string]*cache.Entry
 }
 
-var attrTestData []*AttrTestCase = []*AttrTestCase{
-	&AttrTestCase{
-		[]byte("href"),
-		[]byte("./x"),
-		[]byte(` href="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fx"`),
-	},
-	&AttrTestCase{
-		[]byte("src"),
-		[]byte("http://x.com/y"),
-		[]byte(` src="./?mortyurl=http%3A%2F%2Fx.com%2Fy"`),
-	},
-	&AttrTestCase{
-		[]byte("action"),
-		[]byte("/z"),
-		[]byte(` action="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fz"`),
-	},
-	&AttrTestCase{
-		[]byte("onclick"),
-		[]byte("console.log(document.cookies)"),
-		nil,
-	},
+func (c *memoryCache) Get(key string) (*cache.Entry, bool) {
+	c.Lock()
+	defer c.Unlock()
+	entry, found := c.entries[key]
+	return entry, found
 }
 
-var sanitizeUriTestData []*SanitizeURITestCase = []*SanitizeURITestCase{
-	&SanitizeURITestCase{
-		[]byte("http://example.com/"),
-		[]byte("http://example.com/"),
-		"http:",
-	},
-	&SanitizeURITestCase{
-		[]byte("HtTPs://example.com/     \t"),
-		[]byte("https://example.com/"),
-		"https:",
-	},
-	&SanitizeURITestCase{
-		[]byte("      Ht  TPs://example.com/     \t"),
-		[]byte("https://example.com/"),
-		"https:",
-	},
-	&SanitizeURITestCase{
-		[]byte("javascript:void(0)"),
-		[]byte("javascript:void(0)"),
-		"javascript:",
-	},
-	&SanitizeURITestCase{
-		[]byte("      /path/to/a/file/without/protocol     "),
-		[]byte("/path/to/a/file/without/protocol"),
-		"",
-	},
-	&SanitizeURITestCase{
-		[]byte("      #fragment     "),
-		[]byte("#fragment"),
-		"",
-	},
-	&SanitizeURITestCase{
-		[]byte("      qwertyuiop     "),
-		[]byte("qwertyuiop"),
-		"",
-	},
-	&SanitizeURITestCase{
-		[]byte(""),
-		[]byte(""),
-		"",
+func (c *memoryCache) Set(key string, entry *cache.Entry) error {
+	c.Lock()
+	defer c.Unlock()
+	c.entries[key] = entry
+	return nil
+}
+
+func (c *memoryCache) Delete(key string) error {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.entries, key)
+	return nil
+}
+
+func newTestRequestCtx(method string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI("/")
+	return ctx
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	var requests, conditionalRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditionalRequests++
+			w.WriteHeader(304)
+			return
+		}
+		w.Header().Set("Content-Type", "text/css")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("body { background: url(/a.png); }"))
+	}))
+	defer server.Close()
+
+	// a zero TTL makes every entry stale immediately
+	p := &Proxy{RequestTimeout: 5 * time.Second, Cache: &memoryCache{entries: make(map[string]*cache.Entry)}}
+	var bodies [][]byte
+	for i := 0; i < 2; i++ {
+		ctx := newTestRequestCtx("GET")
+		p.ProcessUri(ctx, server.URL+"/style.css")
+		if ctx.Response.StatusCode() != 200 {
+			t.Fatalf("Unexpected status code: %d", ctx.Response.StatusCode())
+		}
+		if ctx.Response.Header.Peek("ETag") != nil {
+			t.Errorf("The upstream ETag must not be sent to the client")
+		}
+		bodies = append(bodies, append([]byte(nil), ctx.Response.Body()...))
+	}
+	if requests != 2 || conditionalRequests != 1 {
+		t.Errorf("Expected 2 requests including 1 conditional request, got %d and %d", requests, conditionalRequests)
+	}
+	if !bytes.Equal(bodies[0], bodies[1]) || !bytes.Contains(bodies[1], []byte("mortyurl")) {
+		t.Errorf(`The revalidated body differs. Expected: "%s", Got: "%s"`, bodies[0], bodies[1])
+	}
+}
+
+func TestCompressedUpstream(t *testing.T) {
+	page := []byte(`<html><body><p>compressed page</p><script>alert(1)</script></body></html>`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		encoding := r.URL.Path[1:]
+		switch encoding {
+		case "gzip":
+			zw := gzip.NewWriter(&buf)
+			zw.Write(page)
+			zw.Close()
+		case "deflate":
+			zw := zlib.NewWriter(&buf)
+			zw.Write(page)
+			zw.Close()
+		case "br":
+			zw := brotli.NewWriter(&buf)
+			zw.Write(page)
+			zw.Close()
+		case "bomb":
+			encoding = "gzip"
+			zw := gzip.NewWriter(&buf)
+			zw.Write(make([]byte, 8*1024*1024))
+			zw.Close()
+		}
+		if !bytes.Contains([]byte(r.Header.Get("Accept-Encoding")), []byte(encoding)) {
+			t.Errorf(`Compression is not requested. Accept-Encoding: "%s"`, r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	p := &Proxy{RequestTimeout: 5 * time.Second}
+	for _, encoding := range []string{"gzip", "deflate", "br"} {
+		ctx := newTestRequestCtx("GET")
+		p.ProcessUri(ctx, server.URL+"/"+encoding)
+		body := ctx.Response.Body()
+		if ctx.Response.StatusCode() != 200 || !bytes.Contains(body, []byte("<p>compressed page</p>")) {
+			t.Errorf(`Decompression error. Encoding: "%s", Status: %d, Got: "%s"`, encoding, ctx.Response.StatusCode(), body)
+		}
+		if bytes.Contains(body, []byte("alert")) {
+			t.Errorf(`The decompressed page is not sanitized. Encoding: "%s"`, encoding)
+		}
+	}
+
+	// the response to a HEAD request has the Content-Encoding header, but no body
+	ctx := newTestRequestCtx("HEAD")
+	p.ProcessUri(ctx, server.URL+"/gzip")
+	if ctx.Response.StatusCode() != 200 {
+		t.Errorf(`HEAD error. Expected: 200, Got: %d "%s"`, ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	ctx = newTestRequestCtx("GET")
+	p.ProcessUri(ctx, server.URL+"/bomb")
+	if ctx.Response.StatusCode() != 503 {
+		t.Errorf("A decompression bomb must be rejected, got status %d", ctx.Response.StatusCode())
+	}
+}
+
+type CompressTestCase struct {
+	AcceptEncoding   string
+	ContentType      string
+	Stream           bool
+	ExpectedEncoding string
+}
+
+var compressTestData []*CompressTestCase = []*CompressTestCase{
+	&CompressTestCase{"gzip, deflate, br", "text/html; charset=UTF-8", false, "br"},
+	&CompressTestCase{"gzip, deflate", "text/html; charset=UTF-8", false, "gzip"},
+	&CompressTestCase{"gzip, deflate, br", "text/css; charset=UTF-8", true, "br"},
+	&CompressTestCase{"gzip", "text/html; charset=UTF-8", true, "gzip"},
+	&CompressTestCase{"", "text/html; charset=UTF-8", false, ""},
+	&CompressTestCase{"gzip, deflate, br", "image/png", false, ""},
+	&CompressTestCase{"gzip, deflate, br", "application/zip", false, ""},
+}
+
+func TestCompressHandler(t *testing.T) {
+	page := bytes.Repeat([]byte("<p>compressible content</p>\n"), 100)
+	for _, testCase := range compressTestData {
+		handler := compressHandler(func(ctx *fasthttp.RequestCtx) {
+			ctx.SetContentType(testCase.ContentType)
+			if testCase.Stream {
+				ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+					w.Write(page)
+				})
+			} else {
+				ctx.Write(page)
+			}
+		}, 6)
+		ctx := newTestRequestCtx("GET")
+		ctx.Request.Header.Set("Accept-Encoding", testCase.AcceptEncoding)
+		handler(ctx)
+
+		encoding := string(ctx.Response.Header.Peek("Content-Encoding"))
+		if encoding != testCase.ExpectedEncoding {
+			t.Errorf(
+				`Compression error. Accept-Encoding: "%s", Content-Type: "%s", Expected: "%s", Got: "%s"`,
+				testCase.AcceptEncoding,
+				testCase.ContentType,
+				testCase.ExpectedEncoding,
+				encoding,
+			)
+			continue
+		}
+		var body []byte
+		var err error
+		switch encoding {
+		case "br":
+			body, err = ioutil.ReadAll(brotli.NewReader(bytes.NewReader(ctx.Response.Body())))
+		case "gzip":
+			body, err = ctx.Response.BodyGunzip()
+		default:
+			body = ctx.Response.Body()
+		}
+		if err != nil || !bytes.Equal(body, page) {
+			t.Errorf(`Compression error. Encoding: "%s", Stream: %v, the body can't be decoded`, encoding, testCase.Stream)
+		}
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/consent" {
+			http.SetCookie(w, &http.Cookie{Name: "consent", Value: "yes", Path: "/"})
+		}
+		consent, _ := r.Cookie("consent")
+		if consent != nil {
+			w.Write([]byte("<html><body>content</body></html>"))
+		} else {
+			w.Write([]byte("<html><body>cookie wall</body></html>"))
+		}
+	}))
+	defer server.Close()
+
+	sessions, _ := session.NewStore(time.Hour, 10, 4096)
+	p := &Proxy{RequestTimeout: 5 * time.Second, Sessions: sessions}
+
+	// without session
+	ctx := newTestRequestCtx("GET")
+	p.ProcessUri(ctx, server.URL+"/")
+	if ctx.Response.Header.PeekCookie(session.COOKIE_NAME) != nil {
+		t.Errorf("A session must only be created when the upstream server sets cookies")
+	}
+
+	// the upstream server sets a cookie
+	ctx = newTestRequestCtx("GET")
+	p.ProcessUri(ctx, server.URL+"/consent")
+	if ctx.Response.Header.PeekCookie("consent") != nil {
+		t.Errorf("The upstream cookies must not be forwarded to the client")
+	}
+	var sessionCookie fasthttp.Cookie
+	sessionCookie.SetKey(session.COOKIE_NAME)
+	if !ctx.Response.Header.Cookie(&sessionCookie) || len(sessionCookie.Value()) == 0 {
+		t.Fatalf("No session cookie: %s", ctx.Response.Header.String())
+	}
+	if !sessionCookie.HTTPOnly() || string(sessionCookie.Path()) != "/" {
+		t.Errorf("Invalid session cookie: %s", sessionCookie.String())
+	}
+	if !bytes.Contains(ctx.Response.Body(), []byte("mortyclearsession=1")) {
+		t.Errorf("No clear session link in the header")
+	}
+
+	// the next request sends the upstream cookie
+	ctx = newTestRequestCtx("GET")
+	ctx.Request.Header.SetCookieBytesKV(sessionCookie.Key(), sessionCookie.Value())
+	p.ProcessUri(ctx, server.URL+"/")
+	if !bytes.Contains(ctx.Response.Body(), []byte("content")) {
+		t.Errorf("The upstream cookie is not sent: %s", ctx.Response.Body())
+	}
+
+	// clear the session
+	ctx = newTestRequestCtx("GET")
+	ctx.Request.SetRequestURI("/?mortyclearsession=1&mortyurl=" + url.QueryEscape(server.URL+"/"))
+	ctx.Request.Header.SetCookieBytesKV(sessionCookie.Key(), sessionCookie.Value())
+	p.RequestHandler(ctx)
+	if !bytes.Contains(ctx.Response.Body(), []byte("cookie wall")) {
+		t.Errorf("The session is not cleared: %s", ctx.Response.Body())
+	}
+	if sessions.Get(string(sessionCookie.Value())) != nil {
+		t.Errorf("The session is not deleted")
+	}
+}
+
+type RedirectTestCase struct {
+	Method         string
+	Path           string
+	ExpectedStatus int
+	ExpectedBody   string
+}
+
+var redirectTestData []*RedirectTestCase = []*RedirectTestCase{
+	&RedirectTestCase{"GET", "/redirect?status=302&to=/echo", 200, "GET "},
+	&RedirectTestCase{"POST", "/redirect?status=302&to=/echo", 200, "GET "},
+	&RedirectTestCase{"POST", "/redirect?status=303&to=/echo", 200, "GET "},
+	&RedirectTestCase{"PUT", "/redirect?status=303&to=/echo", 200, "GET "},
+	&RedirectTestCase{"POST", "/redirect?status=307&to=/echo", 200, "POST a=1&b=2"},
+	&RedirectTestCase{"PUT", "/redirect?status=308&to=/echo", 200, "PUT a=1&b=2"},
+	&RedirectTestCase{"PUT", "/redirect?status=301&to=/echo", 200, "PUT a=1&b=2"},
+	// relative location
+	&RedirectTestCase{"POST", "/redirect?status=307&to=echo", 200, "POST a=1&b=2"},
+	// loops
+	&RedirectTestCase{"GET", "/redirect?status=302&to=/redirect%3Fstatus%3D302%26to%3D%252Floop", 310, "Redirect loop"},
+	&RedirectTestCase{"GET", "/loop", 310, "Redirect loop"},
+	&RedirectTestCase{"GET", "/chain?n=10", 310, "Too many redirects"},
+	&RedirectTestCase{"GET", "/chain?n=4", 200, "GET "},
+	// other protocols
+	&RedirectTestCase{"GET", "/redirect?status=302&to=ftp://example.com/", 403, "exit MortyProxy"},
+}
+
+func newRedirectTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			status := 302
+			fmt.Sscan(r.URL.Query().Get("status"), &status)
+			w.Header().Set("Location", r.URL.Query().Get("to"))
+			w.WriteHeader(status)
+		case "/loop":
+			http.Redirect(w, r, "/redirect?status=302&to=/loop", 302)
+		case "/chain":
+			var n int
+			fmt.Sscan(r.URL.Query().Get("n"), &n)
+			if n > 0 {
+				http.Redirect(w, r, fmt.Sprintf("/chain?n=%d", n-1), 302)
+			} else {
+				http.Redirect(w, r, "/echo", 302)
+			}
+		case "/echo":
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<html><body><p>%s %s</p></body></html>", r.Method, body)
+		}
+	}))
+}
+
+func TestFollowRedirect(t *testing.T) {
+	server := newRedirectTestServer()
+	defer server.Close()
+
+	p := &Proxy{RequestTimeout: 5 * time.Second, FollowRedirect: true}
+	for _, testCase := range redirectTestData {
+		ctx := newTestRequestCtx(testCase.Method)
+		if testCase.Method != "GET" {
+			ctx.Request.SetBodyString("a=1&b=2")
+		}
+		p.ProcessUri(ctx, server.URL+testCase.Path)
+		if ctx.Response.StatusCode() != testCase.ExpectedStatus || !bytes.Contains(ctx.Response.Body(), []byte(testCase.ExpectedBody)) {
+			t.Errorf(
+				`Redirect error. %s %s, Expected: %d "%s", Got: %d "%s"`,
+				testCase.Method,
+				testCase.Path,
+				testCase.ExpectedStatus,
+				testCase.ExpectedBody,
+				ctx.Response.StatusCode(),
+				ctx.Response.Body(),
+			)
+		}
+	}
+}
+
+func newFormTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if err := r.ParseMultipartForm(1024 * 1024); err != nil && err != http.ErrNotMultipart {
+			fmt.Fprintf(w, "error: %s", err)
+			return
+		}
+		fields := make([]string, 0)
+		for name, values := range r.PostForm {
+			fields = append(fields, name+"="+strings.Join(values, ","))
+		}
+		if r.MultipartForm != nil {
+			for name, files := range r.MultipartForm.File {
+				for _, fh := range files {
+					f, _ := fh.Open()
+					content, _ := ioutil.ReadAll(f)
+					f.Close()
+					fields = append(fields, fmt.Sprintf("%s=%s:%s:%s", name, fh.Filename, fh.Header.Get("Content-Type"), content))
+				}
+			}
+		}
+		sort.Strings(fields)
+		fmt.Fprint(w, strings.Join(fields, "\n"))
+	}))
+}
+
+func TestMultipartForm(t *testing.T) {
+	server := newFormTestServer()
+	defer server.Close()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("mortyurl", server.URL+"/upload")
+	w.WriteField("mortydownload", "1")
+	w.WriteField("q", "morty")
+	part, _ := w.CreateFormFile("file", "a.txt")
+	part.Write([]byte("file content"))
+	w.Close()
+
+	ctx := newTestRequestCtx("POST")
+	ctx.Request.Header.SetContentType(w.FormDataContentType())
+	ctx.Request.SetBody(body.Bytes())
+
+	p := &Proxy{RequestTimeout: 5 * time.Second}
+	p.RequestHandler(ctx)
+
+	expected := "file=a.txt:application/octet-stream:file content\nq=morty"
+	if string(ctx.Response.Body()) != expected {
+		t.Errorf(`Multipart form error. Expected: "%s", Got: "%s"`, expected, ctx.Response.Body())
+	}
+}
+
+func TestMultipartFormOrder(t *testing.T) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("z", "1")
+	w.WriteField("mortyurl", "https://example.com/upload")
+	part, _ := w.CreateFormFile("file", "a.txt")
+	part.Write([]byte("file content"))
+	w.WriteField("a", "2")
+	w.WriteField("mortyformaction:mortyurl=https%3A%2F%2Fexample.com%2F:z", "3")
+	w.WriteField("m", "4")
+	w.Close()
+
+	ctx := newTestRequestCtx("POST")
+	ctx.Request.Header.SetContentType(w.FormDataContentType())
+	ctx.Request.SetBody(body.Bytes())
+	popRequestParam(ctx, []byte("mortyurl"))
+	popFormAction(ctx)
+
+	upstream, contentType, err := upstreamBody(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, _ := mime.ParseMediaType(contentType)
+	r := multipart.NewReader(bytes.NewReader(upstream), params["boundary"])
+	var fields []string
+	for {
+		part, err := r.NextPart()
+		if err != nil {
+			break
+		}
+		value, _ := ioutil.ReadAll(part)
+		fields = append(fields, part.FormName()+"="+string(value))
+	}
+	expected := "z=1 file=file content a=2 z=3 m=4"
+	if strings.Join(fields, " ") != expected {
+		t.Errorf(`Multipart form order error. Expected: "%s", Got: "%s"`, expected, strings.Join(fields, " "))
+	}
+}
+
+func TestURLEncodedForm(t *testing.T) {
+	server := newFormTestServer()
+	defer server.Close()
+
+	ctx := newTestRequestCtx("POST")
+	ctx.Request.Header.SetContentType("application/x-www-form-urlencoded")
+	ctx.Request.SetBodyString("mortyurl=" + url.QueryEscape(server.URL+"/") + "&mortydownload=1&q=morty")
+
+	p := &Proxy{RequestTimeout: 5 * time.Second}
+	p.RequestHandler(ctx)
+
+	if string(ctx.Response.Body()) != "q=morty" {
+		t.Errorf(`Urlencoded form error. Expected: "q=morty", Got: "%s"`, ctx.Response.Body())
+	}
+}
+
+type MethodTestCase struct {
+	Method         string
+	ContentType    string
+	Body           string
+	ExpectedStatus int
+	ExpectedBody   string
+}
+
+var methodTestData []*MethodTestCase = []*MethodTestCase{
+	&MethodTestCase{"GET", "", "", 200, "GET  "},
+	&MethodTestCase{"HEAD", "", "", 200, ""},
+	&MethodTestCase{"OPTIONS", "", "", 200, "OPTIONS "},
+	&MethodTestCase{"POST", "application/json; charset=utf-8; x=y", `{"a":1}`, 200, `POST application/json; charset=utf-8 {"a":1}`},
+	&MethodTestCase{"PUT", "text/plain", "put body", 200, "PUT text/plain put body"},
+	&MethodTestCase{"PATCH", "application/x-www-form-urlencoded", "a=1&b=2", 200, "PATCH application/x-www-form-urlencoded a=1&b=2"},
+	&MethodTestCase{"DELETE", "application/json", `{"id":1}`, 200, `DELETE application/json {"id":1}`},
+	&MethodTestCase{"CONNECT", "", "", 405, "method not allowed"},
+	&MethodTestCase{"TRACE", "", "", 405, "method not allowed"},
+}
+
+func TestMethods(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		if r.URL.Path == "/gzip" {
+			// the Content-Encoding header is sent for the HEAD requests too
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			fmt.Fprintf(zw, "%s %s %s", r.Method, r.Header.Get("Content-Type"), body)
+			zw.Close()
+			return
+		}
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.Header.Get("Content-Type"), body)
+	}))
+	defer server.Close()
+
+	p := &Proxy{RequestTimeout: 5 * time.Second}
+	for _, testCase := range methodTestData {
+		ctx := newTestRequestCtx(testCase.Method)
+		ctx.Request.SetRequestURI("/?mortydownload=1&mortyurl=" + url.QueryEscape(server.URL+"/"))
+		if testCase.ContentType != "" {
+			ctx.Request.Header.SetContentType(testCase.ContentType)
+		}
+		ctx.Request.SetBodyString(testCase.Body)
+		p.RequestHandler(ctx)
+		if ctx.Response.StatusCode() != testCase.ExpectedStatus || !bytes.Contains(ctx.Response.Body(), []byte(testCase.ExpectedBody)) {
+			t.Errorf(
+				`Method error. %s, Expected: %d "%s", Got: %d "%s"`,
+				testCase.Method,
+				testCase.ExpectedStatus,
+				testCase.ExpectedBody,
+				ctx.Response.StatusCode(),
+				ctx.Response.Body(),
+			)
+		}
+	}
+
+	// HEAD responses have no body, even if it is compressed
+	for _, path := range []string{"/", "/gzip"} {
+		ctx := newTestRequestCtx("HEAD")
+		ctx.Request.SetRequestURI("/?mortydownload=1&mortyurl=" + url.QueryEscape(server.URL+path))
+		p.RequestHandler(ctx)
+		if ctx.Response.StatusCode() != 200 || len(ctx.Response.Body()) != 0 {
+			t.Errorf(`HEAD error for %s. Expected: 200 "", Got: %d "%s"`, path, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+	}
+}
+
+func TestConcurrencyTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	finished := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-unblock
+			defer close(finished)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "done")
+	}))
+	defer server.Close()
+
+	p := &Proxy{RequestTimeout: 100 * time.Millisecond, Concurrency: ratelimit.NewConcurrencyLimiter(0, 1)}
+	request := func(path string) int {
+		ctx := newTestRequestCtx("GET")
+		ctx.Request.SetRequestURI("/?mortydownload=1&mortyurl=" + url.QueryEscape(server.URL+path))
+		p.RequestHandler(ctx)
+		return ctx.Response.StatusCode()
+	}
+
+	if status := request("/slow"); status != 504 {
+		t.Fatalf("Timeout error. Expected: 504, Got: %d", status)
+	}
+	// the request which has timed out still holds the slot of the host
+	if status := request("/"); status != 429 {
+		t.Errorf("Concurrency error. Expected: 429, Got: %d", status)
+	}
+	close(unblock)
+	<-finished
+	for i := 0; i < 50; i++ {
+		if status := request("/"); status == 200 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("The slot is not released once the request has finished")
+}
+
+func TestParseMethods(t *testing.T) {
+	methods, err := parseMethods("get, post")
+	if err != nil || !methods["GET"] || !methods["POST"] || len(methods) != 2 {
+		t.Errorf("Unexpected methods: %v, %v", methods, err)
+	}
+	for _, list := range []string{"GET,CONNECT", "GET,trace", "POST"} {
+		if _, err := parseMethods(list); err == nil {
+			t.Errorf(`Expected an error for "%s"`, list)
+		}
+	}
+	p := &Proxy{AllowedMethods: methods}
+	if p.methodAllowed("PUT") || !p.methodAllowed("POST") || p.allowHeader() != "GET, POST" {
+		t.Errorf("Unexpected allowed methods: %s", p.allowHeader())
+	}
+}
+
+func TestProxifyRedirect(t *testing.T) {
+	server := newRedirectTestServer()
+	defer server.Close()
+
+	p := &Proxy{RequestTimeout: 5 * time.Second}
+	ctx := newTestRequestCtx("POST")
+	p.ProcessUri(ctx, server.URL+"/redirect?status=307&to=/echo")
+	expected := "./?mortyurl=" + url.QueryEscape(server.URL+"/echo")
+	if ctx.Response.StatusCode() != 307 || string(ctx.Response.Header.Peek("Location")) != expected {
+		t.Errorf(`Redirect error. Expected: 307 "%s", Got: %d "%s"`, expected, ctx.Response.StatusCode(), ctx.Response.Header.Peek("Location"))
+	}
+}
+
+type SanitizeCommandTestCase struct {
+	Args           []string
+	Stdin          string
+	ExpectedOutput string
+	ExpectedStatus int
+}
+
+var sanitizeCommandTestData []*SanitizeCommandTestCase = []*SanitizeCommandTestCase{
+	&SanitizeCommandTestCase{
+		[]string{"-base-url", "https://x.com/a/"},
+		`<p onclick="x()"><a href="b">b</a><script>x()</script></p>`,
+		`<p><a href="https://x.com/a/b">b</a></p>`,
+		0,
 	},
-	&SanitizeURITestCase{
-		[]byte(":"),
-		[]byte(":"),
-		":",
+	&SanitizeCommandTestCase{
+		[]string{"-base-url", "https://x.com/", "-rewrite", "proxy", "-prefix", "https://morty.example.org/"},
+		`<img src="/i.png" />`,
+		`<img src="https://morty.example.org/?mortyurl=https%3A%2F%2Fx.com%2Fi.png" />`,
+		0,
 	},
-	&SanitizeURITestCase{
-		[]byte("   :"),
-		[]byte(":"),
-		":",
+	&SanitizeCommandTestCase{
+		[]string{"-base-url", "https://x.com/", "-type", "css"},
+		`a { background: url(/i.png) }`,
+		`a { background: url(https://x.com/i.png) }`,
+		0,
 	},
-	&SanitizeURITestCase{
-		[]byte("schéma:"),
-		[]byte("schéma:"),
-		"schéma:",
+	&SanitizeCommandTestCase{
+		[]string{"-base-url", "https://x.com/"},
+		`<a href="http://[::1">a</a>`,
+		`<a>a</a>`,
+		1,
 	},
-}
-
-var urlTestData []*StringTestCase = []*StringTestCase{
-	&StringTestCase{
-		"http://x.com/",
-		"./?mortyurl=http%3A%2F%2Fx.com%2F",
+	&SanitizeCommandTestCase{
+		[]string{"-base-url", "https://x.com/", "-rewrite", "cdn"},
+		``,
+		``,
+		2,
 	},
-	&StringTestCase{
-		"http://a@x.com/",
-		"./?mortyurl=http%3A%2F%2Fa%40x.com%2F",
+	&SanitizeCommandTestCase{
+		[]string{"-rewrite", "none"},
+		`<a href="b#c">b</a><a href="#c">c</a><img src="/i.png" onerror="x()" />`,
+		`<a href="b#c">b</a><a href="#c">c</a><img src="/i.png" />`,
+		0,
 	},
-	&StringTestCase{
-		"#a",
-		"#a",
+	&SanitizeCommandTestCase{
+		[]string{"-rewrite", "proxy"},
+		``,
+		``,
+		2,
 	},
 }
 
-func TestAttrSanitizer(t *testing.T) {
-	u, _ := url.Parse("http://127.0.0.1/")
-	rc := &RequestConfig{BaseURL: u}
-	for _, testCase := range attrTestData {
-		out := bytes.NewBuffer(nil)
-		sanitizeAttr(rc, out, testCase.AttrName, testCase.AttrValue, testCase.AttrValue)
-		res, _ := out.ReadBytes(byte(0))
-		if !bytes.Equal(res, testCase.ExpectedOutput) {
+func TestSanitizeCommand(t *testing.T) {
+	for _, testCase := range sanitizeCommandTestData {
+		stdout := bytes.NewBuffer(nil)
+		stderr := bytes.NewBuffer(nil)
+		status := runSanitizeCommand(testCase.Args, strings.NewReader(testCase.Stdin), stdout, stderr)
+		if status != testCase.ExpectedStatus || stdout.String() != testCase.ExpectedOutput {
 			t.Errorf(
-				`Attribute parse error. Name: "%s", Value: "%s", Expected: %s, Got: "%s"`,
-				testCase.AttrName,
-				testCase.AttrValue,
+				`Sanitize command error. Args: %v, Expected: %d "%s", Got: %d "%s" %s`,
+				testCase.Args,
+				testCase.ExpectedStatus,
 				testCase.ExpectedOutput,
-				res,
+				status,
+				stdout.String(),
+				stderr.String(),
 			)
 		}
 	}
 }
 
-func TestSanitizeURI(t *testing.T) {
-	for _, testCase := range sanitizeUriTestData {
-		newUrl, scheme := sanitizeURI(testCase.Input)
-		if !bytes.Equal(newUrl, testCase.ExpectedOutput) {
-			t.Errorf(
-				`URL proxifier error. Expected: "%s", Got: "%s"`,
-				testCase.ExpectedOutput,
-				newUrl,
-			)
+func TestSanitizeCommandFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "morty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "a.css"), []byte(`a { background: url(b.png) }`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.HTML"), []byte(`<b onclick="x()">b</b>`), 0644)
+
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	args := []string{"-base-url", "https://x.com/", filepath.Join(dir, "a.css"), filepath.Join(dir, "b.HTML")}
+	status := runSanitizeCommand(args, nil, stdout, stderr)
+	expected := `a { background: url(https://x.com/b.png) }<b>b</b>`
+	if status != 0 || stdout.String() != expected {
+		t.Errorf(`Sanitize command error. Expected: 0 "%s", Got: %d "%s" %s`, expected, status, stdout.String(), stderr.String())
+	}
+
+	args = []string{"-base-url", "https://x.com/", filepath.Join(dir, "a.txt")}
+	if status := runSanitizeCommand(args, nil, stdout, stderr); status != 1 {
+		t.Errorf(`Sanitize command error: unknown file type. Expected: 1, Got: %d`, status)
+	}
+
+	// the unreadable documents are reported
+	stderr.Reset()
+	args = []string{filepath.Join(dir, "missing.html"), filepath.Join(dir, "b.HTML")}
+	status = runSanitizeCommand(args, nil, stdout, stderr)
+	expected = "morty sanitize: 0 error(s), 1 unreadable document(s)"
+	if status != 1 || !strings.Contains(stderr.String(), expected) {
+		t.Errorf(`Sanitize command error: missing file. Expected: 1 "%s", Got: %d "%s"`, expected, status, stderr.String())
+	}
+}
+
+func TestAPIFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/page", 301)
+			return
 		}
-		if scheme != testCase.ExpectedScheme {
-			t.Errorf(
-				`URL proxifier error. Expected: "%s", Got: "%s"`,
-				testCase.ExpectedScheme,
-				scheme,
-			)
+		w.Header().Set("Content-Type", "text/html; charset=ISO-8859-1")
+		w.Write([]byte("<html><head><title> Caf\xe9\n page </title></head><body onload=\"x()\">" +
+			"<a href=\"/a\">A <b>link</b></a><a href=\"javascript:x()\">js</a><script>x()</script></body></html>"))
+	}))
+	defer server.Close()
+
+	key := []byte("key")
+	p := &Proxy{Key: key, RequestTimeout: 5 * time.Second}
+	pageURL := server.URL + "/old"
+	ctx := newTestRequestCtx("GET")
+	ctx.Request.SetRequestURI(API_FETCH_PATH + "?url=" + url.QueryEscape(pageURL) + "&hash=" + sanitizer.Hash(pageURL, key))
+	ctx.Request.SetHost("morty.example.org")
+	p.RequestHandler(ctx)
+
+	var result APIFetchResponse
+	if err := json.Unmarshal(ctx.Response.Body(), &result); err != nil {
+		t.Fatalf("Invalid API response: %s %v", ctx.Response.Body(), err)
+	}
+	if result.URL != server.URL+"/page" || result.Status != 200 || result.ContentType != "text/html; charset=UTF-8" || result.Title != "Caf\u00e9 page" {
+		t.Errorf("Unexpected API response: %+v", result)
+	}
+	linkURL := server.URL + "/a"
+	expectedHTML := "<html><head><title> Caf\u00e9\n page </title></head>" + `<body><a href="http://morty.example.org/?mortyhash=` +
+		sanitizer.Hash(linkURL, key) + `&amp;mortyurl=` + url.QueryEscape(linkURL) + `">A <b>link</b></a><a href="">js</a></body></html>`
+	if result.HTML != expectedHTML {
+		t.Errorf(`Unexpected API HTML. Expected: "%s", Got: "%s"`, expectedHTML, result.HTML)
+	}
+	if len(result.Links) != 1 || result.Links[0] != (APILink{linkURL, "A link"}) {
+		t.Errorf("Unexpected API links: %+v", result.Links)
+	}
+
+	ctx = newTestRequestCtx("GET")
+	ctx.Request.SetRequestURI(API_FETCH_PATH + "?url=" + url.QueryEscape(pageURL) + "&hash=00")
+	p.RequestHandler(ctx)
+	if ctx.Response.StatusCode() != 403 || !bytes.Contains(ctx.Response.Body(), []byte(`{"error":`)) {
+		t.Errorf(`API error. Expected: 403, Got: %d "%s"`, ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+}
+
+func TestReaderMode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><title>Article</title></head><body>
+<ul class="menu"><li><a href="/a">Menu link</a></li></ul>
+<div class="content"><p class="byline">By Jane Doe</p>`)
+		for i := 0; i < 5; i++ {
+			fmt.Fprint(w, `<p>A paragraph of the article, long enough to be scored, with <a href="/more">a link</a>.</p>`)
+		}
+		fmt.Fprint(w, `<p onclick="x()">The end.</p><script>x()</script></div></body></html>`)
+	}))
+	defer server.Close()
+
+	p := &Proxy{RequestTimeout: 5 * time.Second}
+	requestReader := func() string {
+		ctx := newTestRequestCtx("GET")
+		ctx.Request.SetRequestURI("/?mortyreader=1&mortyurl=" + url.QueryEscape(server.URL+"/article"))
+		p.RequestHandler(ctx)
+		return string(ctx.Response.Body())
+	}
+
+	body := requestReader()
+	for _, expected := range []string{
+		`<p class="mortyreader-byline">By Jane Doe</p>`,
+		`<a href="./?mortyurl=` + url.QueryEscape(server.URL+"/more") + `">a link</a>`,
+		`<p>The end.</p>`,
+		`Original page</a>`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf(`The reader page has no "%s": %s`, expected, body)
 		}
 	}
+	for _, unexpected := range []string{"Menu link", "x()"} {
+		if strings.Contains(body, unexpected) {
+			t.Errorf(`The reader page has "%s": %s`, unexpected, body)
+		}
+	}
+
+	p.ReaderOptOutHosts = parseHosts("127.0.0.1")
+	body = requestReader()
+	if !strings.Contains(body, "Menu link") || strings.Contains(body, "mortyreader") {
+		t.Errorf("The reader mode of an opted out host is enabled: %s", body)
+	}
 }
 
-func TestURLProxifier(t *testing.T) {
-	u, _ := url.Parse("http://127.0.0.1/")
-	rc := &RequestConfig{BaseURL: u}
-	for _, testCase := range urlTestData {
-		newUrl, err := rc.ProxifyURI([]byte(testCase.Input))
-		if err != nil {
-			t.Errorf("Failed to parse URL: %s", testCase.Input)
+func TestFeed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rdf.xml" || r.URL.Path == "/rdf.rss" {
+			if r.URL.Path == "/rdf.xml" {
+				w.Header().Set("Content-Type", "application/rdf+xml")
+			} else {
+				w.Header().Set("Content-Type", "application/rss+xml")
+			}
+			fmt.Fprint(w, `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">`+
+				`<item rdf:about="https://example.com/1"><title>RDF <script>x()</script></title></item></rdf:RDF>`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml; charset=ISO-8859-1")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="ISO-8859-1"?>
+<rss version="2.0"><channel><title>News</title>
+<item><title>Caf`+"\xe9"+`</title><link>/news/1</link><description>&lt;p onclick="x()"&gt;Text&lt;/p&gt;</description></item>
+</channel></rss>`)
+	}))
+	defer server.Close()
+
+	p := &Proxy{RequestTimeout: 5 * time.Second}
+	ctx := newTestRequestCtx("GET")
+	ctx.Request.SetRequestURI("/?mortyurl=" + url.QueryEscape(server.URL+"/feed.xml"))
+	ctx.Request.SetHost("morty.example.org")
+	p.RequestHandler(ctx)
+
+	if ctx.Response.StatusCode() != 200 {
+		t.Fatalf("Unexpected status. Expected: 200, Got: %d %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+	if string(ctx.Response.Header.ContentType()) != "application/rss+xml; charset=UTF-8" {
+		t.Errorf("Unexpected content type. Expected: application/rss+xml; charset=UTF-8, Got: %s", ctx.Response.Header.ContentType())
+	}
+	body := string(ctx.Response.Body())
+	for _, expected := range []string{
+		"<title>Café</title>",
+		"<link>http://morty.example.org/?mortyurl=" + url.QueryEscape(server.URL+"/news/1") + "</link>",
+		"<description>&lt;p&gt;Text&lt;/p&gt;</description>",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf(`The feed has no "%s": %s`, expected, body)
+		}
+	}
+
+	// the RSS 1.0 feeds are shown by the XML viewer
+	for _, path := range []string{"/rdf.xml", "/rdf.rss"} {
+		ctx = newTestRequestCtx("GET")
+		ctx.Request.SetRequestURI("/?mortyurl=" + url.QueryEscape(server.URL+path))
+		p.RequestHandler(ctx)
+		body = string(ctx.Response.Body())
+		expected := `<span class="mortyviewer-tag">&lt;rdf:RDF</span>`
+		if ctx.Response.StatusCode() != 200 || !strings.Contains(body, expected) || strings.Contains(body, "<script>") {
+			t.Errorf(`The RDF feed %s is not shown by the XML viewer. Expected: 200 "%s", Got: %d "%s"`, path, expected, ctx.Response.StatusCode(), body)
+		}
+	}
+}
+
+func TestXHTML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xhtml+xml")
+		switch r.URL.Path {
+		case "/page.xhtml":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Page</title></head>
+<body><p onclick="x()">Text <a href="/next">next</a></p><script>x()</script></body></html>`)
+		case "/xslt.xhtml":
+			fmt.Fprint(w, `<?xml-stylesheet type="text/xsl" href="t.xsl"?><html xmlns="http://www.w3.org/1999/xhtml"></html>`)
 		}
-		if newUrl != testCase.ExpectedOutput {
+	}))
+	defer server.Close()
+
+	p := &Proxy{RequestTimeout: 5 * time.Second}
+	request := func(path string) *fasthttp.RequestCtx {
+		ctx := newTestRequestCtx("GET")
+		ctx.Request.SetRequestURI("/?mortyurl=" + url.QueryEscape(server.URL+path))
+		p.RequestHandler(ctx)
+		return ctx
+	}
+
+	ctx := request("/page.xhtml")
+	if string(ctx.Response.Header.ContentType()) != "application/xhtml+xml; charset=UTF-8" {
+		t.Errorf("Unexpected content type. Expected: application/xhtml+xml; charset=UTF-8, Got: %s", ctx.Response.Header.ContentType())
+	}
+	body := string(ctx.Response.Body())
+	for _, expected := range []string{
+		`<p>Text <a href="./?mortyurl=` + url.QueryEscape(server.URL+"/next") + `">next</a></p>`,
+		`<meta name="referrer" content="no-referrer" />`,
+		`<input type="checkbox" id="mortytoggle" autocomplete="off" />`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf(`The XHTML document has no "%s": %s`, expected, body)
+		}
+	}
+	if strings.Contains(body, "x()") {
+		t.Errorf("The XHTML document has scripts: %s", body)
+	}
+	if err := xml.Unmarshal(ctx.Response.Body(), new(interface{})); err != nil {
+		t.Errorf("The XHTML document is not well-formed: %v %s", err, body)
+	}
+
+	if ctx = request("/xslt.xhtml"); ctx.Response.StatusCode() != 503 {
+		t.Errorf("Unexpected status of an XSLT document. Expected: 503, Got: %d", ctx.Response.StatusCode())
+	}
+}
+
+func TestViewer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, "User-agent: *\nDisallow: /<script>\n")
+		case "/api":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"name": "<b>morty</b>", "tags": [1, true, null]}`)
+		case "/sitemap.xml":
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml-stylesheet href="t.xsl"?><urlset><url><loc>https://example.com/?a=1&amp;b=<</loc></url></urlset>`)
+		case "/data.csv":
+			w.Header().Set("Content-Type", "text/csv")
+			fmt.Fprint(w, "a,b\n1,<b>2</b>\n")
+		case "/data.tsv":
+			w.Header().Set("Content-Type", "text/tab-separated-values")
+			fmt.Fprint(w, "a\tb\n1\t2\n")
+		case "/data.xml":
+			w.Header().Set("Content-Type", "text/xml")
+			fmt.Fprint(w, `<r><a><script>x()</script></a></r>`)
+		}
+	}))
+	defer server.Close()
+
+	p := &Proxy{RequestTimeout: 5 * time.Second}
+	request := func(query string) *fasthttp.RequestCtx {
+		ctx := newTestRequestCtx("GET")
+		ctx.Request.SetRequestURI("/?" + query)
+		p.RequestHandler(ctx)
+		return ctx
+	}
+
+	ctx := request("mortyurl=" + url.QueryEscape(server.URL+"/robots.txt"))
+	body := string(ctx.Response.Body())
+	if !bytes.HasPrefix(ctx.Response.Header.ContentType(), []byte("text/html")) {
+		t.Errorf("Unexpected content type. Expected: text/html, Got: %s", ctx.Response.Header.ContentType())
+	}
+	if ctx.Response.Header.Peek("Content-Disposition") != nil {
+		t.Errorf("The text viewer is an attachment")
+	}
+	for _, expected := range []string{
+		`<li><code>User-agent: *</code></li><li><code>Disallow: /&lt;script&gt;</code></li>`,
+		`<a href="./?mortydownload=1&amp;mortyurl=` + url.QueryEscape(server.URL+"/robots.txt") + `">Download</a>`,
+		`<div id="mortyheader">`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf(`The text viewer has no "%s": %s`, expected, body)
+		}
+	}
+	if strings.Contains(body, "Reader mode") {
+		t.Errorf("The text viewer has a reader mode link: %s", body)
+	}
+
+	body = string(request("mortyurl=" + url.QueryEscape(server.URL+"/api")).Response.Body())
+	for _, expected := range []string{
+		`<span class="mortyviewer-key">&#34;name&#34;</span>: <span class="mortyviewer-string">&#34;&lt;b&gt;morty&lt;/b&gt;&#34;</span>`,
+		`<summary>[ 3 items</summary>`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf(`The JSON viewer has no "%s": %s`, expected, body)
+		}
+	}
+
+	body = string(request("mortyurl=" + url.QueryEscape(server.URL+"/data.xml")).Response.Body())
+	expected := `<span class="mortyviewer-tag">&lt;script</span><span class="mortyviewer-tag">&gt;</span><span class="mortyviewer-string">x()</span>`
+	if !strings.Contains(body, expected) || strings.Contains(body, "<script>") {
+		t.Errorf(`The XML viewer has no "%s": %s`, expected, body)
+	}
+	// invalid XML documents are shown as text
+	body = string(request("mortyurl=" + url.QueryEscape(server.URL+"/sitemap.xml")).Response.Body())
+	expected = `<li><code>&lt;?xml-stylesheet href=&#34;t.xsl&#34;?&gt;&lt;urlset&gt;`
+	if !strings.Contains(body, expected) {
+		t.Errorf(`The XML viewer has no "%s": %s`, expected, body)
+	}
+
+	// the Download link of each viewer
+	for path, expected := range map[string]string{
+		"/robots.txt":  "User-agent: *\nDisallow: /<script>\n",
+		"/data.csv":    "a,b\n1,<b>2</b>\n",
+		"/data.tsv":    "a\tb\n1\t2\n",
+		"/api":         `{"name": "<b>morty</b>", "tags": [1, true, null]}`,
+		"/data.xml":    `<r><a><script>x()</script></a></r>`,
+		"/sitemap.xml": `<?xml-stylesheet href="t.xsl"?><urlset><url><loc>https://example.com/?a=1&amp;b=<</loc></url></urlset>`,
+	} {
+		ctx = request("mortydownload=1&mortyurl=" + url.QueryEscape(server.URL+path))
+		if ctx.Response.StatusCode() != 200 {
+			t.Errorf("Download error for %s. Expected: 200, Got: %d", path, ctx.Response.StatusCode())
+		}
+		if !bytes.HasPrefix(ctx.Response.Header.Peek("Content-Disposition"), []byte("attachment")) {
+			t.Errorf("The download of %s is not an attachment: %s", path, ctx.Response.Header.Peek("Content-Disposition"))
+		}
+		if string(ctx.Response.Body()) != expected {
+			t.Errorf("Unexpected download of %s. Expected: %s, Got: %s", path, expected, ctx.Response.Body())
+		}
+	}
+}
+
+const TEST_PDF = "%PDF-1.4\n1 0 obj\n<< /Type /Catalog /OpenAction << /S /JavaScript /JS (x\\(\\)) >> >>\nendobj\n" +
+	"trailer\n<< /Root 1 0 R >>\n%%EOF\n"
+
+func TestPDFSafeView(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		switch r.URL.Path {
+		case "/doc.pdf":
+			io.WriteString(w, TEST_PDF)
+		case "/encrypted.pdf":
+			io.WriteString(w, "%PDF-1.4\ntrailer\n<< /Encrypt 2 0 R >>\n%%EOF\n")
+		}
+	}))
+	defer server.Close()
+
+	p := &Proxy{RequestTimeout: 5 * time.Second, PDFSafeView: true}
+	request := func(params string) *fasthttp.RequestCtx {
+		ctx := newTestRequestCtx("GET")
+		ctx.Request.SetRequestURI("/?" + params)
+		p.RequestHandler(ctx)
+		return ctx
+	}
+
+	ctx := request("mortyurl=" + url.QueryEscape(server.URL+"/doc.pdf"))
+	if ctx.Response.Header.Peek("Content-Disposition") != nil {
+		t.Errorf("The PDF file is not inline: %s", ctx.Response.Header.Peek("Content-Disposition"))
+	}
+	expected := "/XXXXXXXXXX << /S /XXXXXXXXXX /XX (x\\(\\)) >>"
+	if body := string(ctx.Response.Body()); !strings.Contains(body, expected) || len(body) != len(TEST_PDF) {
+		t.Errorf(`The PDF file has no "%s": %s`, expected, body)
+	}
+
+	// the original file is downloaded
+	for _, params := range []string{
+		"mortydownload=1&mortyurl=" + url.QueryEscape(server.URL+"/doc.pdf"),
+		"mortyurl=" + url.QueryEscape(server.URL+"/encrypted.pdf"),
+	} {
+		ctx = request(params)
+		if !bytes.HasPrefix(ctx.Response.Header.Peek("Content-Disposition"), []byte("attachment")) {
+			t.Errorf("The download is not an attachment: %s", ctx.Response.Header.Peek("Content-Disposition"))
+		}
+	}
+	if body := string(ctx.Response.Body()); !strings.Contains(body, "/Encrypt") {
+		t.Errorf("Unexpected download. Got: %s", body)
+	}
+}
+
+func TestContentSniffing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/untyped":
+			// net/http sniffs the content type when the header is nil
+			w.Header()["Content-Type"] = nil
+			fmt.Fprint(w, `<html><body><p onclick="x()">Text</p><script>x()</script></body></html>`)
+		case "/unknown":
+			w.Header().Set("Content-Type", "unknown/unknown")
+			fmt.Fprint(w, "GIF89a\x01\x00\x01\x00\x00\x00\x00;")
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, `<!DOCTYPE html><script>x()</script>`)
+		case "/polyglot.gif":
+			w.Header().Set("Content-Type", "image/gif")
+			fmt.Fprint(w, "GIF89a\x01\x00\x01\x00\x00\x00\x00;<script>x()</script>")
+		}
+	}))
+	defer server.Close()
+
+	p := &Proxy{RequestTimeout: 5 * time.Second}
+	request := func(path string) *fasthttp.RequestCtx {
+		ctx := newTestRequestCtx("GET")
+		ctx.Request.SetRequestURI("/?mortyurl=" + url.QueryEscape(server.URL+path))
+		p.RequestHandler(ctx)
+		return ctx
+	}
+
+	for _, testCase := range []struct {
+		Path        string
+		Status      int
+		ContentType string
+	}{
+		{"/untyped", 200, "text/html; charset=UTF-8"},
+		{"/unknown", 200, "image/gif"},
+		{"/image.png", 403, "text/html; charset=UTF-8"},
+		{"/polyglot.gif", 200, "image/gif"},
+	} {
+		ctx := request(testCase.Path)
+		if ctx.Response.StatusCode() != testCase.Status {
+			t.Errorf("Unexpected status for %s. Expected: %d, Got: %d", testCase.Path, testCase.Status, ctx.Response.StatusCode())
+		}
+		if string(ctx.Response.Header.ContentType()) != testCase.ContentType {
+			t.Errorf("Unexpected content type for %s. Expected: %s, Got: %s", testCase.Path, testCase.ContentType, ctx.Response.Header.ContentType())
+		}
+		if string(ctx.Response.Header.Peek("X-Content-Type-Options")) != "nosniff" {
+			t.Errorf("Unexpected X-Content-Type-Options for %s. Got: %s", testCase.Path, ctx.Response.Header.Peek("X-Content-Type-Options"))
+		}
+	}
+
+	body := string(request("/untyped").Response.Body())
+	if !strings.Contains(body, "<p>Text</p>") || strings.Contains(body, "x()") {
+		t.Errorf("The sniffed HTML document is not sanitized: %s", body)
+	}
+}
+
+type ClientIPTestCase struct {
+	RemoteAddr     string
+	ForwardedFor   string
+	ExpectedOutput string
+}
+
+var clientIPTestData []*ClientIPTestCase = []*ClientIPTestCase{
+	// untrusted peer: X-Forwarded-For is ignored
+	&ClientIPTestCase{"192.0.2.1", "198.51.100.1", "192.0.2.1"},
+	// trusted peer
+	&ClientIPTestCase{"10.0.0.1", "198.51.100.1", "198.51.100.1"},
+	// chain of trusted proxies, the client can't spoof the first address
+	&ClientIPTestCase{"10.0.0.1", "203.0.113.7, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+	// trusted peer without header
+	&ClientIPTestCase{"10.0.0.1", "", "10.0.0.1"},
+	// invalid address
+	&ClientIPTestCase{"10.0.0.1", "unknown", "10.0.0.1"},
+	&ClientIPTestCase{"::1", "2001:db8::1", "2001:db8::1"},
+}
+
+func TestClientIP(t *testing.T) {
+	trustedProxies, err := parseNetworks("10.0.0.0/8, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{TrustedProxies: trustedProxies}
+	for _, testCase := range clientIPTestData {
+		var req fasthttp.Request
+		if testCase.ForwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", testCase.ForwardedFor)
+		}
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(&req, &net.TCPAddr{IP: net.ParseIP(testCase.RemoteAddr)}, nil)
+		if ip := p.clientIP(ctx); ip != testCase.ExpectedOutput {
 			t.Errorf(
-				`URL proxifier error. Expected: "%s", Got: "%s"`,
+				`Client IP error. Remote: "%s", X-Forwarded-For: "%s", Expected: "%s", Got: "%s"`,
+				testCase.RemoteAddr,
+				testCase.ForwardedFor,
 				testCase.ExpectedOutput,
-				newUrl,
+				ip,
 			)
 		}
 	}
 }
 
-var BENCH_SIMPLE_HTML []byte = []byte(`<!doctype html>
-<html>
- <head>
-  <title>test</title>
- </head>
- <body>
-  <h1>Test heading</h1>
- </body>
-</html>`)
-
-func BenchmarkSanitizeSimpleHTML(b *testing.B) {
-	u, _ := url.Parse("http://127.0.0.1/")
-	rc := &RequestConfig{BaseURL: u}
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		out := bytes.NewBuffer(nil)
-		sanitizeHTML(rc, out, BENCH_SIMPLE_HTML)
-	}
-}
-
-var BENCH_COMPLEX_HTML []byte = []byte(`<!doctype html>
-<html>
- <head>
-  <noscript><meta http-equiv="refresh" content="0; URL=./xy"></noscript>
-  <title>test 2</title>
-  <script> alert('xy'); </script>
-  <link rel="stylesheet" href="./core.bundle.css">
-  <style>
-   html { background: url(./a.jpg); }
-  </style
- </head>
- <body>
-  <h1>Test heading</h1>
-  <img src="b.png" alt="imgtitle" />
-  <form action="/z">
-  <input type="submit" style="background: url(http://aa.bb/cc)" >
-  </form>
- </body>
-</html>`)
-
-func BenchmarkSanitizeComplexHTML(b *testing.B) {
-	u, _ := url.Parse("http://127.0.0.1/")
-	rc := &RequestConfig{BaseURL: u}
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		out := bytes.NewBuffer(nil)
-		sanitizeHTML(rc, out, BENCH_COMPLEX_HTML)
+func TestRateLimitKey(t *testing.T) {
+	for _, testCase := range []struct {
+		Input          string
+		ExpectedOutput string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{"::ffff:192.0.2.1", "::ffff:192.0.2.1"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+		{"2001:db8:1:2::7", "2001:db8:1:2::/64"},
+	} {
+		if key := rateLimitKey(testCase.Input); key != testCase.ExpectedOutput {
+			t.Errorf(`Rate limit key error. IP: "%s", Expected: "%s", Got: "%s"`, testCase.Input, testCase.ExpectedOutput, key)
+		}
 	}
 }
@@ -0,0 +1,262 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/lzw"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/asciimoo/morty/decompress"
+)
+
+// IMAGE_FILTERS decode images: their output is not parsed by the PDF readers, unless the stream
+// is not an image.
+var IMAGE_FILTERS map[string]bool = map[string]bool{
+	"CCF":            true,
+	"CCITTFaxDecode": true,
+	"DCT":            true,
+	"DCTDecode":      true,
+	"JBIG2Decode":    true,
+	"JPXDecode":      true,
+}
+
+// UnsupportedFilterError is returned for the streams which can't be decoded, so not checked.
+type UnsupportedFilterError string
+
+func (e UnsupportedFilterError) Error() string {
+	return fmt.Sprintf("unsupported PDF filter: %s", string(e))
+}
+
+// decodeStream returns the decoded data of the stream, or nil for the images.
+func decodeStream(s *stream, limits decompress.Limits) ([]byte, error) {
+	filters, params := streamFilters(s.dict)
+	data := s.data
+	for i, filter := range filters {
+		var err error
+		switch filter {
+		case "FlateDecode", "Fl":
+			data, err = decompress.Decode([]byte("deflate"), data, limits)
+			if err == nil {
+				data, err = unpredict(data, params[i])
+			}
+		case "LZWDecode", "LZW":
+			if earlyChange, ok := params[i]["EarlyChange"].(keyword); ok && earlyChange != "1" {
+				return nil, UnsupportedFilterError("LZWDecode without early change")
+			}
+			data, err = readLimited(lzw.NewReader(bytes.NewReader(data), lzw.MSB, 8), limits)
+			if err == nil {
+				data, err = unpredict(data, params[i])
+			}
+		case "ASCIIHexDecode", "AHx":
+			data, err = decodeASCIIHex(data)
+		case "ASCII85Decode", "A85":
+			data, err = decodeASCII85(data, limits)
+		case "RunLengthDecode", "RL":
+			data, err = decodeRunLength(data, limits)
+		default:
+			if IMAGE_FILTERS[filter] && i == len(filters)-1 && s.dict["Subtype"] == name("Image") {
+				return nil, nil
+			}
+			return nil, UnsupportedFilterError(filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// streamFilters returns the filters of the stream and their parameters. An indirect filter is
+// returned as an unknown filter.
+func streamFilters(d dict) ([]string, []dict) {
+	var filters []string
+	switch f := d["Filter"].(type) {
+	case nil:
+	case name:
+		filters = []string{string(f)}
+	case array:
+		for _, item := range f {
+			n, _ := item.(name)
+			filters = append(filters, string(n))
+		}
+	default:
+		filters = []string{"indirect"}
+	}
+	params := make([]dict, len(filters))
+	switch p := d["DecodeParms"].(type) {
+	case dict:
+		if len(params) > 0 {
+			params[0] = p
+		}
+	case array:
+		for i, item := range p {
+			if i < len(params) {
+				params[i], _ = item.(dict)
+			}
+		}
+	}
+	return filters, params
+}
+
+func readLimited(r io.Reader, limits decompress.Limits) ([]byte, error) {
+	if limits.MaxSize > 0 {
+		r = io.LimitReader(r, int64(limits.MaxSize)+1)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxSize > 0 && len(data) > limits.MaxSize {
+		return nil, decompress.ErrTooLarge
+	}
+	return data, nil
+}
+
+func intParam(params dict, key string, defaultValue int) int {
+	if value, ok := params[key].(keyword); ok {
+		if n, err := strconv.Atoi(string(value)); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+// unpredict reverses the TIFF and PNG predictors of the Flate and LZW filters.
+func unpredict(data []byte, params dict) ([]byte, error) {
+	predictor := intParam(params, "Predictor", 1)
+	if predictor == 1 {
+		return data, nil
+	}
+	colors := intParam(params, "Colors", 1)
+	bpc := intParam(params, "BitsPerComponent", 8)
+	columns := intParam(params, "Columns", 1)
+	if colors < 1 || colors > 32 || bpc < 1 || bpc > 16 || columns < 1 || columns > len(data)*8 {
+		return nil, errors.New("invalid PDF predictor parameters")
+	}
+	bpp := (colors*bpc + 7) / 8
+	rowLength := (colors*bpc*columns + 7) / 8
+
+	if predictor == 2 {
+		if bpc != 8 {
+			return nil, UnsupportedFilterError("TIFF predictor")
+		}
+		for row := 0; row+rowLength <= len(data); row += rowLength {
+			for i := row + bpp; i < row+rowLength; i++ {
+				data[i] += data[i-bpp]
+			}
+		}
+		return data, nil
+	}
+	if predictor < 10 {
+		return nil, UnsupportedFilterError("predictor " + strconv.Itoa(predictor))
+	}
+
+	// each PNG row starts with its filter type
+	out := make([]byte, 0, len(data))
+	previous := make([]byte, rowLength)
+	for row := 0; row+1+rowLength <= len(data); row += 1 + rowLength {
+		current := data[row+1 : row+1+rowLength]
+		for i := range current {
+			var left, upLeft byte
+			if i >= bpp {
+				left = current[i-bpp]
+				upLeft = previous[i-bpp]
+			}
+			up := previous[i]
+			switch data[row] {
+			case 0:
+			case 1:
+				current[i] += left
+			case 2:
+				current[i] += up
+			case 3:
+				current[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				current[i] += paeth(left, up, upLeft)
+			default:
+				return nil, errors.New("invalid PNG predictor")
+			}
+		}
+		out = append(out, current...)
+		previous = current
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	if end := bytes.IndexByte(data, '>'); end >= 0 {
+		data = data[:end]
+	}
+	digits := make([]byte, 0, len(data))
+	for _, c := range data {
+		if !isWhitespace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	_, err := hex.Decode(out, digits)
+	return out, err
+}
+
+func decodeASCII85(data []byte, limits decompress.Limits) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+	return readLimited(ascii85.NewDecoder(bytes.NewReader(data)), limits)
+}
+
+func decodeRunLength(data []byte, limits decompress.Limits) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(data); {
+		length := int(data[i])
+		switch {
+		case length == 128:
+			return out, nil
+		case length < 128:
+			if i+2+length > len(data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			out = append(out, data[i+1:i+2+length]...)
+			i += 2 + length
+		default:
+			if i+1 >= len(data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			out = append(out, bytes.Repeat(data[i+1:i+2], 257-length)...)
+			i += 2
+		}
+		if limits.MaxSize > 0 && len(out) > limits.MaxSize {
+			return nil, decompress.ErrTooLarge
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,341 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+)
+
+// MAX_OBJECT_DEPTH is the maximum nesting depth of the dictionaries and the arrays.
+const MAX_OBJECT_DEPTH = 64
+
+const (
+	tokenEOF int = iota
+	tokenKeyword
+	tokenName
+	tokenString
+	tokenDictStart
+	tokenDictEnd
+	tokenArrayStart
+	tokenArrayEnd
+)
+
+type token struct {
+	kind  int
+	value []byte // the decoded name, or the keyword
+}
+
+// The objects of the dictionaries: name, keyword (numbers, booleans), reference, dict, array, or
+// nil for the strings.
+type name string
+type keyword string
+type dict map[string]interface{}
+type array []interface{}
+
+// reference is an indirect object of a dictionary. The references of the arrays are read as
+// keywords.
+type reference struct {
+	number     keyword
+	generation keyword
+}
+
+// stream is a stream of the file: keyword is the index of its stream keyword, data is its encoded
+// data.
+type stream struct {
+	dict    dict
+	keyword int
+	start   int
+	end     int
+	data    []byte
+}
+
+var errUnterminatedString = errors.New("invalid PDF: unterminated string")
+
+func isWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isRegular(c byte) bool {
+	return !isWhitespace(c) && !isDelimiter(c)
+}
+
+// decodeName decodes the #xx escapes of a name.
+func decodeName(raw []byte) string {
+	if bytes.IndexByte(raw, '#') < 0 {
+		return string(raw)
+	}
+	decoded := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if b, err := strconv.ParseUint(string(raw[i+1:i+3]), 16, 8); err == nil {
+				decoded = append(decoded, byte(b))
+				i += 2
+				continue
+			}
+		}
+		decoded = append(decoded, raw[i])
+	}
+	return string(decoded)
+}
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isWhitespace(c):
+			l.pos++
+		case c == '%':
+			// comment
+			for l.pos < len(l.data) && l.data[l.pos] != '\r' && l.data[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '/':
+			start := l.pos + 1
+			l.pos = start
+			for l.pos < len(l.data) && isRegular(l.data[l.pos]) {
+				l.pos++
+			}
+			return token{tokenName, []byte(decodeName(l.data[start:l.pos]))}, nil
+		case c == '(':
+			return token{kind: tokenString}, l.skipString()
+		case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+			l.pos += 2
+			return token{kind: tokenDictStart}, nil
+		case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+			l.pos += 2
+			return token{kind: tokenDictEnd}, nil
+		case c == '<':
+			end := bytes.IndexByte(l.data[l.pos:], '>')
+			if end < 0 {
+				return token{}, errUnterminatedString
+			}
+			l.pos += end + 1
+			return token{kind: tokenString}, nil
+		case c == '[':
+			l.pos++
+			return token{kind: tokenArrayStart}, nil
+		case c == ']':
+			l.pos++
+			return token{kind: tokenArrayEnd}, nil
+		case isDelimiter(c):
+			// unbalanced delimiters are ignored
+			l.pos++
+		default:
+			start := l.pos
+			for l.pos < len(l.data) && isRegular(l.data[l.pos]) {
+				l.pos++
+			}
+			return token{tokenKeyword, l.data[start:l.pos]}, nil
+		}
+	}
+	return token{kind: tokenEOF}, nil
+}
+
+// skipString skips a literal string, with its balanced parentheses and its escapes.
+func (l *lexer) skipString() error {
+	depth := 0
+	for ; l.pos < len(l.data); l.pos++ {
+		switch l.data[l.pos] {
+		case '\\':
+			l.pos++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				l.pos++
+				return nil
+			}
+		}
+	}
+	return errUnterminatedString
+}
+
+// object parses the object starting with t.
+func (l *lexer) object(t token, depth int) (interface{}, error) {
+	if depth > MAX_OBJECT_DEPTH {
+		return nil, errors.New("invalid PDF: objects too deep")
+	}
+	switch t.kind {
+	case tokenName:
+		return name(t.value), nil
+	case tokenKeyword:
+		return keyword(t.value), nil
+	case tokenDictStart:
+		d := make(dict)
+		var lastKey string
+		// the keywords following the last value, like the generation of a reference
+		var following []keyword
+		for {
+			key, err := l.next()
+			if err != nil {
+				return nil, err
+			}
+			switch key.kind {
+			case tokenDictEnd:
+				return d, nil
+			case tokenEOF:
+				return nil, errors.New("invalid PDF: unterminated dictionary")
+			case tokenName:
+				value, err := l.next()
+				if err != nil {
+					return nil, err
+				}
+				lastKey = string(key.value)
+				following = nil
+				if d[lastKey], err = l.object(value, depth+1); err != nil {
+					return nil, err
+				}
+			default:
+				// the generation and the R keyword of a reference, or an invalid key
+				if key.kind == tokenKeyword && string(key.value) == "R" && len(following) == 1 {
+					if number, ok := d[lastKey].(keyword); ok {
+						d[lastKey] = reference{number, following[0]}
+					}
+				}
+				obj, err := l.object(key, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				if k, ok := obj.(keyword); ok {
+					following = append(following, k)
+				}
+			}
+		}
+	case tokenArrayStart:
+		var a array
+		for {
+			item, err := l.next()
+			if err != nil {
+				return nil, err
+			}
+			switch item.kind {
+			case tokenArrayEnd:
+				return a, nil
+			case tokenEOF:
+				return nil, errors.New("invalid PDF: unterminated array")
+			}
+			value, err := l.object(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, value)
+		}
+	case tokenDictEnd:
+		return nil, errors.New("invalid PDF: unexpected end of dictionary")
+	}
+	return nil, nil
+}
+
+// streams returns the streams of the file. The length of each stream must be valid: the readers
+// would search the endstream keyword otherwise, and may not find the same one.
+func streams(data []byte) ([]*stream, error) {
+	l := &lexer{data: data}
+	var found []*stream
+	var objects map[reference]int
+	for {
+		t, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == tokenEOF {
+			return found, nil
+		}
+		if t.kind != tokenDictStart {
+			continue
+		}
+		obj, err := l.object(t, 0)
+		if err != nil {
+			return nil, err
+		}
+		// the stream keyword follows the dictionary
+		pos := l.pos
+		for pos < len(data) && isWhitespace(data[pos]) {
+			pos++
+		}
+		if !isStreamKeyword(data, pos) {
+			continue
+		}
+		s := &stream{dict: obj.(dict), keyword: pos, start: pos + len("stream")}
+		if bytes.HasPrefix(data[s.start:], []byte("\r\n")) {
+			s.start += 2
+		} else if s.start < len(data) && data[s.start] == '\n' {
+			s.start++
+		}
+
+		var length int
+		switch value := s.dict["Length"].(type) {
+		case keyword:
+			length, err = strconv.Atoi(string(value))
+		case reference:
+			if objects == nil {
+				objects = integerObjects(data)
+			}
+			var ok bool
+			if length, ok = objects[value]; !ok {
+				err = errors.New("invalid PDF: unknown stream length")
+			}
+		default:
+			err = errors.New("invalid PDF: stream without length")
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.end = s.start + length
+		if length < 0 || s.end > len(data) {
+			return nil, errors.New("invalid PDF: invalid stream length")
+		}
+		pos = s.end
+		for pos < len(data) && isWhitespace(data[pos]) {
+			pos++
+		}
+		if !bytes.HasPrefix(data[pos:], []byte("endstream")) {
+			return nil, errors.New("invalid PDF: invalid stream length")
+		}
+		s.data = data[s.start:s.end]
+		found = append(found, s)
+		l.pos = pos + len("endstream")
+	}
+}
+
+// isStreamKeyword returns true if a stream keyword starts at pos: it is followed by an end of
+// line.
+func isStreamKeyword(data []byte, pos int) bool {
+	if !bytes.HasPrefix(data[pos:], []byte("stream")) || (pos > 0 && isRegular(data[pos-1])) {
+		return false
+	}
+	end := pos + len("stream")
+	return end < len(data) && (data[end] == '\r' || data[end] == '\n')
+}
+
+var integerObjectRegexp = regexp.MustCompile(`(?:^|[^0-9])([0-9]+)\s+([0-9]+)\s+obj\s+([0-9]+)\s+endobj`)
+
+// integerObjects returns the values of the integer objects of the file, used as stream lengths.
+// The last definition of an object replaces the previous ones, like in the incremental updates.
+func integerObjects(data []byte) map[reference]int {
+	objects := make(map[reference]int)
+	for _, match := range integerObjectRegexp.FindAllSubmatch(data, -1) {
+		if value, err := strconv.Atoi(string(match[3])); err == nil {
+			objects[reference{keyword(match[1]), keyword(match[2])}] = value
+		}
+	}
+	return objects
+}
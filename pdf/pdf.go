@@ -0,0 +1,162 @@
+// Package pdf removes the active content of the PDF files: JavaScript, automatic actions, links,
+// launched programs, embedded files and forms.
+package pdf
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/asciimoo/morty/decompress"
+)
+
+// PDF_UNSAFE_NAMES are the names of the dictionary keys and the action types removed from the
+// files.
+var PDF_UNSAFE_NAMES map[string]bool = map[string]bool{
+	"AA":             true,
+	"EmbeddedFile":   true,
+	"EmbeddedFiles":  true,
+	"FileAttachment": true,
+	"GoToE":          true,
+	"GoToR":          true,
+	"ImportData":     true,
+	"JS":             true,
+	"JavaScript":     true,
+	"Launch":         true,
+	"Movie":          true,
+	"OpenAction":     true,
+	"Rendition":      true,
+	"RichMedia":      true,
+	"Sound":          true,
+	"SubmitForm":     true,
+	"URI":            true,
+	"XFA":            true,
+}
+
+// ErrInvalidPDF is returned if the file doesn't start with a PDF header or doesn't end with an
+// end-of-file marker.
+var ErrInvalidPDF = errors.New("invalid PDF file")
+
+// ErrEncrypted is returned for the encrypted files: their strings and streams can't be checked.
+var ErrEncrypted = errors.New("encrypted PDF file")
+
+// ErrUnsafeStream is returned if a compressed stream, like an object stream, contains an unsafe
+// name: it can't be removed without rewriting the stream.
+var ErrUnsafeStream = errors.New("unsafe PDF stream")
+
+// ErrUnknownStream is returned if a stream keyword doesn't belong to a stream of the file: the
+// readers may find a stream which is not checked.
+var ErrUnknownStream = errors.New("unknown PDF stream")
+
+// Sanitize returns a copy of the PDF file without its unsafe names. The names are replaced by
+// names of the same length, so the offsets of the objects are kept. The streams are decoded with
+// limits, and the file is rejected if a decoded stream contains an unsafe name, or if a stream
+// can't be decoded.
+func Sanitize(data []byte, limits decompress.Limits) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, ErrInvalidPDF
+	}
+	tail := data
+	if len(tail) > 1024 {
+		tail = tail[len(tail)-1024:]
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return nil, ErrInvalidPDF
+	}
+
+	found, err := streams(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStreamKeywords(data, found); err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, s := range found {
+		if s.dict["Type"] == name("XRef") {
+			continue
+		}
+		decoded, err := decodeStream(s, limits)
+		if err != nil {
+			return nil, err
+		}
+		total += len(decoded)
+		if limits.MaxSize > 0 && total > limits.MaxSize {
+			return nil, decompress.ErrTooLarge
+		}
+		// the data of the images is not parsed
+		if s.dict["Subtype"] == name("Image") && s.dict["Type"] != name("ObjStm") {
+			continue
+		}
+		unsafe := false
+		scanNames(decoded, func(start, end int, n string) {
+			unsafe = unsafe || PDF_UNSAFE_NAMES[n] || n == "Encrypt"
+		})
+		if unsafe {
+			return nil, ErrUnsafeStream
+		}
+	}
+
+	out := make([]byte, len(data))
+	copy(out, data)
+	encrypted := false
+	previous := 0
+	for _, s := range append(found, &stream{start: len(data), end: len(data)}) {
+		scanNames(data[previous:s.start], func(start, end int, n string) {
+			if n == "Encrypt" {
+				encrypted = true
+			}
+			if PDF_UNSAFE_NAMES[n] {
+				for i := previous + start; i < previous+end; i++ {
+					out[i] = 'X'
+				}
+			}
+		})
+		previous = s.end
+	}
+	if encrypted {
+		return nil, ErrEncrypted
+	}
+	return out, nil
+}
+
+// checkStreamKeywords checks that each stream keyword of the file is the keyword of a stream, or
+// is in the data of a stream.
+func checkStreamKeywords(data []byte, found []*stream) error {
+	i := 0
+	for pos := 0; ; {
+		index := bytes.Index(data[pos:], []byte("stream"))
+		if index < 0 {
+			return nil
+		}
+		pos += index
+		for i < len(found) && found[i].end <= pos {
+			i++
+		}
+		inStream := i < len(found) && (found[i].keyword == pos || found[i].start <= pos)
+		if !inStream && isStreamKeyword(data, pos) {
+			return ErrUnknownStream
+		}
+		pos += len("stream")
+	}
+}
+
+// scanNames calls f with the raw bytes indexes and the decoded value of each name of data,
+// without its slash.
+func scanNames(data []byte, f func(start, end int, n string)) {
+	for pos := 0; ; {
+		index := bytes.IndexByte(data[pos:], '/')
+		if index < 0 {
+			return
+		}
+		start := pos + index + 1
+		end := start
+		for end < len(data) && isRegular(data[end]) {
+			end++
+		}
+		if end > start {
+			f(start, end, decodeName(data[start:end]))
+		}
+		pos = end
+	}
+}
@@ -0,0 +1,151 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/lzw"
+	"compress/zlib"
+	"encoding/ascii85"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/asciimoo/morty/decompress"
+)
+
+var testLimits decompress.Limits = decompress.Limits{MaxSize: 10 * 1024 * 1024, MaxRatio: 100}
+
+func zlibBytes(b []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	w := zlib.NewWriter(buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func lzwBytes(b []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	w := lzw.NewWriter(buf, lzw.MSB, 8)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func ascii85Bytes(b []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	w := ascii85.NewEncoder(buf)
+	w.Write(b)
+	w.Close()
+	buf.WriteString("~>")
+	return buf.Bytes()
+}
+
+// newPDF returns a PDF file with the objects, which are numbered from 1.
+func newPDF(objects ...string) []byte {
+	buf := bytes.NewBufferString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	var offsets []int
+	for i, obj := range objects {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// newStream returns a stream object with the data.
+func newStream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+var CATALOG string = "<< /Type /Catalog /Pages 2 0 R /OpenAction 4 0 R /Names << /JavaScript 5 0 R /EmbeddedFiles 6 0 R >> >>"
+var PAGES string = "<< /Type /Pages /Kids [3 0 R] /Count 1 >>"
+var PAGE string = "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 7 0 R /Annots [<< /Subtype /Link /A << /S /URI /URI (https://example.com/) >> >>] /A#41 << /O << /S /J#61vaScript /JS (app.alert\\(1\\)) >> >> >>"
+var ACTION string = "<< /S /Launch /F (calc.exe) >>"
+
+var CONTENT []byte = []byte("BT /F1 24 Tf 100 700 Td (Hello) Tj ET")
+
+func TestSanitize(t *testing.T) {
+	input := newPDF(CATALOG, PAGES, PAGE, ACTION, "<< /Names [(x) 4 0 R] >>", "<< >>",
+		newStream("/Filter /FlateDecode", zlibBytes(CONTENT)))
+	out, err := Sanitize(input, testLimits)
+	if err != nil {
+		t.Fatalf("PDF error: %v", err)
+	}
+	if len(out) != len(input) {
+		t.Errorf("PDF length error. Expected: %d, Got: %d", len(input), len(out))
+	}
+	for _, unsafe := range []string{"OpenAction", "/JavaScript", "/JS", "EmbeddedFiles", "/URI", "/A#41", "J#61vaScript", "Launch"} {
+		if bytes.Contains(out, []byte(unsafe)) {
+			t.Errorf("Unsafe PDF. Unexpected: %s, Got: %s", unsafe, out)
+		}
+	}
+	for _, expected := range []string{"/XXXXXXXXXX 4 0 R", "/S /XXX /XXX (https://example.com/)", "/Contents 7 0 R", "(calc.exe)"} {
+		if !bytes.Contains(out, []byte(expected)) {
+			t.Errorf("PDF error. Expected: %s, Got: %s", expected, out)
+		}
+	}
+	if !bytes.Contains(out, zlibBytes(CONTENT)) {
+		t.Errorf("PDF error. The stream is modified: %s", out)
+	}
+}
+
+func TestSanitizeStreams(t *testing.T) {
+	// the predictor 12 (PNG up) with 4 columns
+	predicted := []byte{0, 'B', 'T', ' ', '/', 2, 0, 0, 0, 0}
+	for _, obj := range []string{
+		newStream("", CONTENT),
+		newStream("/Filter /FlateDecode", zlibBytes(CONTENT)),
+		newStream("/Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 4 >>", zlibBytes(predicted)),
+		newStream("/Filter [/AHx /LZW]", []byte(fmt.Sprintf("%x>", lzwBytes(CONTENT)))),
+		newStream("/Filter /ASCII85Decode", ascii85Bytes(CONTENT)),
+		newStream("/Filter /RunLengthDecode", []byte("\x01BT\xfd \x80")),
+		newStream("/Type /XObject /Subtype /Image /Filter [/FlateDecode /DCTDecode]", zlibBytes([]byte("\xff\xd8/JS"))),
+		newStream("/Length1 3", []byte("no stream\nin the data")),
+		"<< /Length 8 0 R >>\nstream\n" + string(CONTENT) + "\nendstream\nendobj\n8 0 obj\n" + fmt.Sprint(len(CONTENT)),
+	} {
+		if _, err := Sanitize(newPDF(CATALOG, PAGES, PAGE, obj), testLimits); err != nil {
+			t.Errorf("PDF stream error. Stream: %s, Got: %v", obj, err)
+		}
+	}
+}
+
+func TestSanitizeErrors(t *testing.T) {
+	objStm := []byte("5 0 6 20 << /S /JavaScript >> << /Type /Catalog >>")
+	for _, testCase := range []struct {
+		Input []byte
+		Error error
+	}{
+		{[]byte("<html>%PDF-1.7\n%%EOF"), ErrInvalidPDF},
+		{[]byte("%PDF-1.7\n1 0 obj\n<< >>\nendobj\n"), ErrInvalidPDF},
+		{newPDF(CATALOG, "<< /Filter /Standard /V 2 /R 3 >>", "<< /Encrypt 2 0 R >>"), ErrEncrypted},
+		{newPDF(CATALOG, newStream("/Type /ObjStm /N 2 /First 8 /Filter /FlateDecode", zlibBytes(objStm))), ErrUnsafeStream},
+		{newPDF(CATALOG, newStream("/Type /ObjStm /N 2 /First 8 /Filter /A85", ascii85Bytes(objStm))), ErrUnsafeStream},
+		{newPDF(CATALOG, newStream("/Filter /FlateDecode", zlibBytes([]byte("/Encr#79pt")))), ErrUnsafeStream},
+		{newPDF(CATALOG, "(x) stream\n/JavaScript\nendstream"), ErrUnknownStream},
+		{newPDF(CATALOG, newStream("/Filter /Crypt", CONTENT)), UnsupportedFilterError("Crypt")},
+		{newPDF(CATALOG, newStream("/Filter /DCTDecode", CONTENT)), UnsupportedFilterError("DCTDecode")},
+		{newPDF(CATALOG, newStream("/Filter 9 0 R", CONTENT)), UnsupportedFilterError("indirect")},
+		{newPDF(CATALOG, newStream("/Filter /FlateDecode", zlibBytes(bytes.Repeat([]byte("BT ET\n"), 1024*1024)))), decompress.ErrRatio},
+	} {
+		if _, err := Sanitize(testCase.Input, testLimits); err != testCase.Error {
+			t.Errorf("PDF error. Expected: %v, Got: %v", testCase.Error, err)
+		}
+	}
+
+	// the readers would find another stream in the data of the invalid lengths
+	for _, obj := range []string{
+		"<< /Length 2 >>\nstream\n" + string(CONTENT) + "\nendstream",
+		"<< /Length 9 0 R >>\nstream\n" + string(CONTENT) + "\nendstream",
+		"<< >>\nstream\n" + string(CONTENT) + "\nendstream",
+		"<< /Length 99999 >>\nstream\n" + string(CONTENT) + "\nendstream",
+		"<< /Length 1 /Filter (x >>\nstream\n" + string(CONTENT) + "\nendstream",
+	} {
+		if _, err := Sanitize(newPDF(CATALOG, obj), testLimits); err == nil || !strings.HasPrefix(err.Error(), "invalid PDF") {
+			t.Errorf("PDF stream error. Stream: %s, Got: %v", obj, err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Policy lists the attributes the HTML sanitizer keeps. An attribute is kept when it is a global
+// attribute, when it starts with one of the prefixes, or when it is allowed on its element.
+// The URL attributes of an element are kept once the sanitizer has rewritten their URL.
+//
+// Event handlers (on*) can't be allowed, nor the URL attributes of the default policy outside of
+// URLs: they would be kept without being rewritten. The style attribute is not listed: the
+// sanitizer always rewrites it.
+type Policy struct {
+	// Extend adds the rules to the default policy instead of replacing it.
+	Extend   bool                `json:"extend,omitempty"`
+	Global   []string            `json:"global"`
+	Prefixes []string            `json:"prefixes"`
+	Elements map[string][]string `json:"elements"`
+	URLs     map[string][]string `json:"urls"`
+
+	global   map[string]bool
+	prefixes []string
+	elements map[string]map[string]bool
+	urls     map[string]map[string]bool
+}
+
+var DEFAULT_GLOBAL_ATTRIBUTES = []string{
+	"accesskey",
+	"align",
+	"autocapitalize",
+	"class",
+	"contenteditable",
+	"contextmenu",
+	"dir",
+	"draggable",
+	"enterkeyhint",
+	"hidden",
+	"id",
+	"inputmode",
+	"itemid",
+	"itemprop",
+	"itemref",
+	"itemscope",
+	"itemtype",
+	"lang",
+	"property",
+	"role",
+	"spellcheck",
+	"tabindex",
+	"title",
+	"translate",
+}
+
+var DEFAULT_PREFIXES = []string{
+	"aria-",
+	"data-",
+}
+
+var DEFAULT_ELEMENT_ATTRIBUTES = map[string][]string{
+	"a":        {"hreflang", "name", "rel", "target", "type"},
+	"area":     {"alt", "coords", "hreflang", "rel", "shape", "target"},
+	"audio":    {"controls", "loop", "muted", "preload"},
+	"bdo":      {"dir"},
+	"button":   {"disabled", "form", "formenctype", "formmethod", "formnovalidate", "formtarget", "name", "type", "value"},
+	"col":      {"span", "width"},
+	"colgroup": {"span", "width"},
+	"data":     {"value"},
+	"del":      {"datetime"},
+	"details":  {"open"},
+	"dialog":   {"open"},
+	"fieldset": {"disabled", "form", "name"},
+	"form":     {"autocomplete", "enctype", "method", "name", "novalidate", "rel", "target"},
+	"frame":    {"name"},
+	"iframe":   {"height", "name", "width"},
+	"img":      {"alt", "decoding", "height", "ismap", "loading", "width"},
+	"input":    {"alt", "autocomplete", "checked", "disabled", "form", "formenctype", "formmethod", "formnovalidate", "formtarget", "height", "list", "max", "maxlength", "min", "minlength", "multiple", "name", "pattern", "placeholder", "readonly", "required", "size", "step", "type", "value", "width"},
+	"ins":      {"datetime"},
+	"label":    {"for", "form"},
+	"li":       {"value"},
+	"link":     {"as", "hreflang", "media", "rel", "sizes", "type"},
+	"map":      {"name"},
+	"meta":     {"content", "name"},
+	"meter":    {"high", "low", "max", "min", "optimum", "value"},
+	"object":   {"form", "height", "name", "type", "width"},
+	"ol":       {"reversed", "start", "type"},
+	"optgroup": {"disabled", "label"},
+	"option":   {"disabled", "label", "selected", "value"},
+	"output":   {"for", "form", "name"},
+	"progress": {"max", "value"},
+	"select":   {"autocomplete", "disabled", "form", "multiple", "name", "required", "size"},
+	"source":   {"media", "sizes", "type"},
+	"style":    {"media"},
+	"table":    {"border", "cellpadding", "cellspacing", "summary", "width"},
+	"td":       {"colspan", "headers", "height", "nowrap", "rowspan", "width"},
+	"textarea": {"autocomplete", "cols", "disabled", "form", "maxlength", "minlength", "name", "placeholder", "readonly", "required", "rows", "wrap"},
+	"th":       {"abbr", "colspan", "headers", "height", "nowrap", "rowspan", "scope", "width"},
+	"time":     {"datetime"},
+	"track":    {"default", "kind", "label", "srclang"},
+	"ul":       {"type"},
+	"video":    {"controls", "height", "loop", "muted", "playsinline", "preload", "width"},
+}
+
+// DEFAULT_URL_ATTRIBUTES are the attributes whose URL is rewritten.
+var DEFAULT_URL_ATTRIBUTES = map[string][]string{
+	"a":          {"href"},
+	"area":       {"href"},
+	"audio":      {"src"},
+	"blockquote": {"cite"},
+	"body":       {"background"},
+	"button":     {"formaction"},
+	"del":        {"cite"},
+	"form":       {"action"},
+	"frame":      {"longdesc", "src"},
+	"html":       {"manifest"},
+	"iframe":     {"longdesc", "src"},
+	// the browsers parse image as img
+	"image":  {"src"},
+	"img":    {"longdesc", "src", "usemap"},
+	"input":  {"formaction", "src", "usemap"},
+	"ins":    {"cite"},
+	"link":   {"href"},
+	"object": {"data", "usemap"},
+	"q":      {"cite"},
+	"source": {"src"},
+	"table":  {"background"},
+	"td":     {"background"},
+	"th":     {"background"},
+	"track":  {"src"},
+	"video":  {"poster", "src"},
+}
+
+// DEFAULT covers the harmless HTML5 attributes.
+var DEFAULT *Policy
+
+func init() {
+	var err error
+	DEFAULT, err = New(DEFAULT_GLOBAL_ATTRIBUTES, DEFAULT_PREFIXES, DEFAULT_ELEMENT_ATTRIBUTES, DEFAULT_URL_ATTRIBUTES)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// New returns a policy. The names are case insensitive.
+func New(global, prefixes []string, elements, urls map[string][]string) (*Policy, error) {
+	p := &Policy{
+		Global:   global,
+		Prefixes: prefixes,
+		Elements: elements,
+		URLs:     urls,
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Load reads a JSON policy.
+func Load(r io.Reader) (*Policy, error) {
+	p := &Policy{}
+	if err := json.NewDecoder(r).Decode(p); err != nil {
+		return nil, err
+	}
+	if p.Extend {
+		p.Global = append(append([]string{}, DEFAULT.Global...), p.Global...)
+		p.Prefixes = append(append([]string{}, DEFAULT.Prefixes...), p.Prefixes...)
+		p.Elements = mergeElements(DEFAULT.Elements, p.Elements)
+		p.URLs = mergeElements(DEFAULT.URLs, p.URLs)
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadFile reads a JSON policy from a file.
+func LoadFile(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// URL reports whether the attribute of the element is an URL to rewrite. Both names must be lower
+// case.
+func (p *Policy) URL(element, attr []byte) bool {
+	return p.urls[string(element)][string(attr)]
+}
+
+// Allowed reports whether the attribute is kept on the element. Both names must be lower case.
+func (p *Policy) Allowed(element, attr []byte) bool {
+	if p.global[string(attr)] || p.elements[string(element)][string(attr)] {
+		return true
+	}
+	for _, prefix := range p.prefixes {
+		if len(attr) > len(prefix) && string(attr[:len(prefix)]) == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) compile() error {
+	var err error
+	if p.urls, err = compileElements(p.URLs); err != nil {
+		return err
+	}
+	p.global = make(map[string]bool)
+	for _, attr := range p.Global {
+		attr = strings.ToLower(attr)
+		if err := checkAttribute(attr); err != nil {
+			return err
+		}
+		// the URL attributes are only kept once rewritten
+		if isURLAttribute(attr) {
+			return fmt.Errorf("URL attribute %q is not listed in urls", attr)
+		}
+		p.global[attr] = true
+	}
+	p.prefixes = nil
+	for _, prefix := range p.Prefixes {
+		prefix = strings.ToLower(prefix)
+		// a prefix must not match the event handlers nor the URL attributes
+		if prefix == "" || strings.HasPrefix("on", prefix) || strings.HasPrefix(prefix, "on") || prefixesURLAttribute(prefix) {
+			return fmt.Errorf("invalid attribute prefix %q", prefix)
+		}
+		p.prefixes = append(p.prefixes, prefix)
+	}
+	if p.elements, err = compileElements(p.Elements); err != nil {
+		return err
+	}
+	for element, attrs := range p.elements {
+		for attr := range attrs {
+			if isURLAttribute(attr) && !p.urls[element][attr] {
+				return fmt.Errorf("URL attribute %q of %q is not listed in urls", attr, element)
+			}
+		}
+	}
+	return nil
+}
+
+// isURLAttribute reports whether attr is a URL attribute of an element of the default policy, or
+// another attribute loading a URL.
+func isURLAttribute(attr string) bool {
+	if attr == "ping" || attr == "srcset" {
+		return true
+	}
+	for _, attrs := range DEFAULT_URL_ATTRIBUTES {
+		for _, urlAttr := range attrs {
+			if attr == urlAttr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// prefixesURLAttribute reports whether a URL attribute starts with prefix.
+func prefixesURLAttribute(prefix string) bool {
+	if strings.HasPrefix("ping", prefix) || strings.HasPrefix("srcset", prefix) {
+		return true
+	}
+	for _, attrs := range DEFAULT_URL_ATTRIBUTES {
+		for _, urlAttr := range attrs {
+			if strings.HasPrefix(urlAttr, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compileElements(elements map[string][]string) (map[string]map[string]bool, error) {
+	compiled := make(map[string]map[string]bool)
+	for element, attrs := range elements {
+		element = strings.ToLower(element)
+		if compiled[element] == nil {
+			compiled[element] = make(map[string]bool)
+		}
+		for _, attr := range attrs {
+			attr = strings.ToLower(attr)
+			if err := checkAttribute(attr); err != nil {
+				return nil, err
+			}
+			compiled[element][attr] = true
+		}
+	}
+	return compiled, nil
+}
+
+func mergeElements(a, b map[string][]string) map[string][]string {
+	merged := make(map[string][]string)
+	for element, attrs := range a {
+		merged[element] = append([]string{}, attrs...)
+	}
+	for element, attrs := range b {
+		merged[element] = append(merged[element], attrs...)
+	}
+	return merged
+}
+
+func checkAttribute(attr string) error {
+	if attr == "" || strings.HasPrefix(attr, "on") || attr == "style" {
+		return fmt.Errorf("invalid attribute %q", attr)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+type AllowedTestCase struct {
+	Element  string
+	Attr     string
+	Expected bool
+}
+
+var defaultTestData []*AllowedTestCase = []*AllowedTestCase{
+	&AllowedTestCase{"div", "class", true},
+	&AllowedTestCase{"div", "aria-label", true},
+	&AllowedTestCase{"div", "data-id", true},
+	&AllowedTestCase{"div", "data-", false},
+	&AllowedTestCase{"span", "itemprop", true},
+	&AllowedTestCase{"td", "colspan", true},
+	&AllowedTestCase{"div", "colspan", false},
+	&AllowedTestCase{"ol", "reversed", true},
+	&AllowedTestCase{"time", "datetime", true},
+	&AllowedTestCase{"div", "onclick", false},
+	&AllowedTestCase{"div", "style", false},
+	&AllowedTestCase{"div", "value", false},
+	&AllowedTestCase{"input", "value", true},
+	&AllowedTestCase{"meta", "content", true},
+	&AllowedTestCase{"div", "content", false},
+}
+
+var urlTestData []*AllowedTestCase = []*AllowedTestCase{
+	&AllowedTestCase{"a", "href", true},
+	&AllowedTestCase{"div", "href", false},
+	&AllowedTestCase{"blockquote", "cite", true},
+	&AllowedTestCase{"img", "longdesc", true},
+	&AllowedTestCase{"body", "background", true},
+	&AllowedTestCase{"object", "data", true},
+	&AllowedTestCase{"html", "manifest", true},
+	&AllowedTestCase{"frame", "src", true},
+	&AllowedTestCase{"image", "src", true},
+	&AllowedTestCase{"video", "poster", true},
+	&AllowedTestCase{"img", "alt", false},
+}
+
+func TestDefaultURLs(t *testing.T) {
+	for _, testCase := range urlTestData {
+		if DEFAULT.URL([]byte(testCase.Element), []byte(testCase.Attr)) != testCase.Expected {
+			t.Errorf(`URL policy error. Element: "%s", Attribute: "%s", Expected: %v`, testCase.Element, testCase.Attr, testCase.Expected)
+		}
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	for _, testCase := range defaultTestData {
+		if DEFAULT.Allowed([]byte(testCase.Element), []byte(testCase.Attr)) != testCase.Expected {
+			t.Errorf(`Policy error. Element: "%s", Attribute: "%s", Expected: %v`, testCase.Element, testCase.Attr, testCase.Expected)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	p, err := Load(strings.NewReader(`{"global": ["Lang"], "prefixes": ["x-"], "elements": {"TD": ["nowrap"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range []*AllowedTestCase{
+		&AllowedTestCase{"div", "lang", true},
+		&AllowedTestCase{"div", "x-a", true},
+		&AllowedTestCase{"td", "nowrap", true},
+		&AllowedTestCase{"div", "class", false},
+		&AllowedTestCase{"div", "data-id", false},
+	} {
+		if p.Allowed([]byte(testCase.Element), []byte(testCase.Attr)) != testCase.Expected {
+			t.Errorf(`Loaded policy error. Element: "%s", Attribute: "%s", Expected: %v`, testCase.Element, testCase.Attr, testCase.Expected)
+		}
+	}
+
+	if p.URL([]byte("a"), []byte("href")) {
+		t.Errorf("Loaded policy error: unexpected URL attribute")
+	}
+
+	p, err = Load(strings.NewReader(`{"extend": true, "elements": {"td": ["char"]}, "urls": {"div": ["data-src"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Allowed([]byte("td"), []byte("char")) || !p.Allowed([]byte("td"), []byte("colspan")) || !p.Allowed([]byte("div"), []byte("data-id")) {
+		t.Errorf("Extended policy error")
+	}
+	if !p.URL([]byte("div"), []byte("data-src")) || !p.URL([]byte("a"), []byte("href")) {
+		t.Errorf("Extended policy error: missing URL attribute")
+	}
+
+	// a URL attribute allowed on an element is rewritten
+	if _, err := Load(strings.NewReader(`{"elements": {"a": ["href"]}, "urls": {"a": ["href"]}}`)); err != nil {
+		t.Errorf("Policy error: %v", err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, policy := range []string{
+		`{"global": ["onclick"]}`,
+		`{"elements": {"a": ["ONmouseover"]}}`,
+		`{"prefixes": ["o"]}`,
+		`{"prefixes": ["on"]}`,
+		`{"prefixes": [""]}`,
+		`{"urls": {"a": ["onclick"]}}`,
+		`{"global": ["style"]}`,
+		`{"global": ["href"]}`,
+		`{"global": ["SrcSet"]}`,
+		`{"extend": true, "elements": {"a": ["ping"]}}`,
+		`{"elements": {"video": ["poster"]}}`,
+		`{"elements": {"button": ["formaction"]}, "urls": {"input": ["formaction"]}}`,
+		`{"prefixes": ["s"]}`,
+		`{"prefixes": ["h"]}`,
+		`{"prefixes": ["form"]}`,
+		`{"global": `,
+	} {
+		if _, err := Load(strings.NewReader(policy)); err == nil {
+			t.Errorf(`Expected an error for %s`, policy)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// MAX_BUCKETS is the maximum number of buckets of a Limiter: the least recently used bucket is
+// evicted when a new key comes.
+var MAX_BUCKETS int = 100000
+
+type bucket struct {
+	key     string
+	tokens  float64
+	last    time.Time
+	element *list.Element
+}
+
+// Limiter is a token bucket rate limiter with one bucket per key (typically a client IP address).
+type Limiter struct {
+	rate       float64 // tokens added per second
+	burst      float64 // capacity of a bucket
+	maxBuckets int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lru       *list.List // front is the most recently used bucket
+	lastPurge time.Time
+	now       func() time.Time
+}
+
+// NewLimiter returns a Limiter allowing rate requests per second per key, with bursts of up to
+// burst requests.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:       rate,
+		burst:      float64(burst),
+		maxBuckets: MAX_BUCKETS,
+		buckets:    make(map[string]*bucket),
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// Allow consumes a token of the key bucket and reports whether there was one.
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.purge(now)
+
+	b, found := l.buckets[key]
+	if !found {
+		if len(l.buckets) >= l.maxBuckets {
+			l.remove(l.lru.Back().Value.(*bucket))
+		}
+		b = &bucket{key: key, tokens: l.burst, last: now}
+		b.element = l.lru.PushFront(b)
+		l.buckets[key] = b
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * l.rate
+		if b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+		b.last = now
+		l.lru.MoveToFront(b.element)
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// purge removes the buckets which are full again: forgetting them doesn't change anything. It runs
+// at most once per fill duration, and only visits the removed buckets and the oldest remaining one:
+// a bucket is kept for less than two fill durations after its last request.
+func (l *Limiter) purge(now time.Time) {
+	fillDuration := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastPurge) < fillDuration {
+		return
+	}
+	for l.lru.Len() > 0 {
+		b := l.lru.Back().Value.(*bucket)
+		if now.Sub(b.last) < fillDuration {
+			break
+		}
+		l.remove(b)
+	}
+	l.lastPurge = now
+}
+
+func (l *Limiter) remove(b *bucket) {
+	delete(l.buckets, b.key)
+	l.lru.Remove(b.element)
+}
+
+// ConcurrencyLimiter caps the number of simultaneous operations, globally and per key
+// (typically a destination host). A zero limit disables the corresponding cap.
+type ConcurrencyLimiter struct {
+	max       int
+	maxPerKey int
+
+	mu      sync.Mutex
+	current int
+	perKey  map[string]int
+}
+
+func NewConcurrencyLimiter(max, maxPerKey int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		max:       max,
+		maxPerKey: maxPerKey,
+		perKey:    make(map[string]int),
+	}
+}
+
+// Acquire reserves a slot for key without waiting. It reports false when a cap is reached;
+// otherwise Release must be called once the operation is finished.
+func (l *ConcurrencyLimiter) Acquire(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.max > 0 && l.current >= l.max {
+		return false
+	}
+	if l.maxPerKey > 0 && l.perKey[key] >= l.maxPerKey {
+		return false
+	}
+	l.current++
+	l.perKey[key]++
+	return true
+}
+
+func (l *ConcurrencyLimiter) Release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.current--
+	l.perKey[key]--
+	if l.perKey[key] <= 0 {
+		delete(l.perKey, key)
+	}
+}
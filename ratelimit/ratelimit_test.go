@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("a") {
+			t.Errorf("Request %d of the burst must be allowed", i)
+		}
+	}
+	if l.Allow("a") {
+		t.Errorf("The bucket must be empty after the burst")
+	}
+	if !l.Allow("b") {
+		t.Errorf("Keys must have their own bucket")
+	}
+
+	// 2 tokens per second: one token after 500ms
+	now = now.Add(500 * time.Millisecond)
+	if !l.Allow("a") {
+		t.Errorf("A token must be added after 500ms")
+	}
+	if l.Allow("a") {
+		t.Errorf("Only one token must be added after 500ms")
+	}
+
+	// full buckets are forgotten
+	now = now.Add(time.Minute)
+	l.Allow("c")
+	if len(l.buckets) != 1 {
+		t.Errorf("Expected 1 bucket after the purge, got %d", len(l.buckets))
+	}
+}
+
+func TestLimiterPurgePeriod(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(1, 10)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 20000; i++ {
+		l.Allow(strconv.Itoa(i))
+	}
+	purged := l.lastPurge
+	// the buckets are not scanned before the end of the fill duration (10s), even if they are many
+	now = now.Add(9 * time.Second)
+	l.Allow("a")
+	if !l.lastPurge.Equal(purged) || len(l.buckets) != 20001 {
+		t.Errorf("Unexpected purge before the fill duration: %d buckets", len(l.buckets))
+	}
+	now = now.Add(time.Second)
+	l.Allow("b")
+	if len(l.buckets) != 2 {
+		t.Errorf("Expected 2 buckets after the purge, got %d", len(l.buckets))
+	}
+}
+
+func TestLimiterMaxBuckets(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(1, 1)
+	l.now = func() time.Time { return now }
+	l.maxBuckets = 2
+
+	l.Allow("a")
+	l.Allow("b")
+	// "a" becomes the most recently used bucket
+	l.Allow("a")
+	l.Allow("c")
+	if len(l.buckets) != 2 || l.buckets["b"] != nil {
+		t.Errorf("The least recently used bucket must be evicted: %v", l.buckets)
+	}
+	if l.Allow("a") {
+		t.Errorf("The recently used bucket must be kept")
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l := NewConcurrencyLimiter(3, 2)
+
+	if !l.Acquire("a") || !l.Acquire("a") {
+		t.Fatalf("The first two requests to a host must be allowed")
+	}
+	if l.Acquire("a") {
+		t.Errorf("The per key limit is not enforced")
+	}
+	if !l.Acquire("b") {
+		t.Fatalf("Another host must be allowed")
+	}
+	if l.Acquire("c") {
+		t.Errorf("The global limit is not enforced")
+	}
+	l.Release("a")
+	if !l.Acquire("c") {
+		t.Errorf("A released slot must be available")
+	}
+	l.Release("a")
+	l.Release("b")
+	l.Release("c")
+	if l.current != 0 || len(l.perKey) != 0 {
+		t.Errorf("Unexpected state after the releases: %d, %v", l.current, l.perKey)
+	}
+
+	unlimited := NewConcurrencyLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		if !unlimited.Acquire("a") {
+			t.Fatalf("A zero limit must disable the cap")
+		}
+	}
+}
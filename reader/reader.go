@@ -0,0 +1,378 @@
+// Package reader extracts the main article of an HTML document, like the reader views of the
+// browsers: the nodes are scored by the length of their paragraphs, their commas, their link
+// density and their class and id names, and the best one is kept with its related siblings.
+//
+// The extracted content is not sanitized.
+package reader
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNoArticle is returned when the document has no article, like a search page or a form.
+var ErrNoArticle = errors.New("no article found")
+
+// Article is the main content of a document. The URLs of the content are absolute.
+type Article struct {
+	Title   string
+	Byline  string
+	Image   string // URL of the lead image
+	Content string // HTML of the article
+}
+
+// MIN_ARTICLE_LENGTH is the minimum length of the text of an article.
+const MIN_ARTICLE_LENGTH = 250
+
+// MIN_PARAGRAPH_LENGTH is the minimum length of the text of a paragraph which adds to the score of
+// its ancestors.
+const MIN_PARAGRAPH_LENGTH = 25
+
+// REMOVED_ELEMENTS are never part of an article.
+var REMOVED_ELEMENTS map[atom.Atom]bool = map[atom.Atom]bool{
+	atom.Aside:    true,
+	atom.Button:   true,
+	atom.Embed:    true,
+	atom.Footer:   true,
+	atom.Form:     true,
+	atom.Iframe:   true,
+	atom.Input:    true,
+	atom.Nav:      true,
+	atom.Noscript: true,
+	atom.Object:   true,
+	atom.Script:   true,
+	atom.Select:   true,
+	atom.Style:    true,
+	atom.Textarea: true,
+}
+
+// UNLIKELY_CANDIDATES_REGEXP matches the class and id names of the navigation, the comments and the
+// ads, unless MAYBE_CANDIDATE_REGEXP matches them too.
+var UNLIKELY_CANDIDATES_REGEXP *regexp.Regexp = regexp.MustCompile(`(?i)-ad-|banner|breadcrumbs|combx|comment|community|cookie|disqus|extra|foot|header|legends|menu|modal|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup|yom-remote`)
+
+var MAYBE_CANDIDATE_REGEXP *regexp.Regexp = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+
+var POSITIVE_REGEXP *regexp.Regexp = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|pagination|post|text|blog|story`)
+
+var NEGATIVE_REGEXP *regexp.Regexp = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+
+var BYLINE_REGEXP *regexp.Regexp = regexp.MustCompile(`(?i)byline|author|dateline|writtenby|p-author`)
+
+var COMMA_REGEXP *regexp.Regexp = regexp.MustCompile(`[,，、]`)
+
+// Extract returns the main article of the UTF-8 HTML document read from r. baseURL resolves the
+// relative URLs, unless the document has a <base> element.
+func Extract(r io.Reader, baseURL *url.URL) (*Article, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &extractor{baseURL: baseURL, scores: make(map[*html.Node]float64)}
+	e.readMetadata(doc)
+	e.prepare(doc)
+
+	top := e.topCandidate(doc)
+	if top == nil {
+		return nil, ErrNoArticle
+	}
+	content := e.articleNodes(top)
+	length := 0
+	for _, n := range content {
+		length += len(textContent(n))
+	}
+	if length < MIN_ARTICLE_LENGTH {
+		return nil, ErrNoArticle
+	}
+
+	article := &Article{Title: e.title, Byline: e.byline, Image: e.image}
+	buf := bytes.NewBuffer(nil)
+	for _, n := range content {
+		e.absoluteURLs(n)
+		if article.Image == "" {
+			article.Image = firstImage(n)
+		}
+		if err := html.Render(buf, n); err != nil {
+			return nil, err
+		}
+	}
+	article.Content = buf.String()
+	return article, nil
+}
+
+type extractor struct {
+	baseURL *url.URL
+	title   string
+	byline  string
+	image   string
+	scores  map[*html.Node]float64
+}
+
+// readMetadata reads the title, the byline, the lead image and the base URL of the document.
+func (e *extractor) readMetadata(doc *html.Node) {
+	var docTitle, ogTitle, ogImage string
+	walk(doc, func(n *html.Node) bool {
+		switch n.DataAtom {
+		case atom.Title:
+			if docTitle == "" {
+				docTitle = collapseSpaces(textContent(n))
+			}
+		case atom.Base:
+			if href, err := url.Parse(attr(n, "href")); err == nil && attr(n, "href") != "" {
+				e.baseURL = e.baseURL.ResolveReference(href)
+			}
+		case atom.Meta:
+			name := strings.ToLower(attr(n, "name") + attr(n, "property"))
+			content := strings.TrimSpace(attr(n, "content"))
+			switch name {
+			case "og:title", "twitter:title":
+				if ogTitle == "" {
+					ogTitle = content
+				}
+			case "og:image", "twitter:image":
+				if ogImage == "" {
+					ogImage = content
+				}
+			case "author":
+				if e.byline == "" {
+					e.byline = content
+				}
+			}
+		}
+		return true
+	})
+	e.title = ogTitle
+	if e.title == "" {
+		e.title = docTitle
+	}
+	if ogImage != "" {
+		e.image = e.absoluteURL(ogImage)
+	}
+}
+
+// prepare removes the elements which are never part of an article, and the unlikely candidates.
+// It reads the byline.
+func (e *extractor) prepare(doc *html.Node) {
+	var removed []*html.Node
+	walk(doc, func(n *html.Node) bool {
+		if n.Type == html.CommentNode {
+			removed = append(removed, n)
+			return false
+		}
+		if n.Type != html.ElementNode {
+			return true
+		}
+		if REMOVED_ELEMENTS[n.DataAtom] {
+			removed = append(removed, n)
+			return false
+		}
+		names := attr(n, "class") + " " + attr(n, "id")
+		if e.byline == "" && (attr(n, "rel") == "author" || BYLINE_REGEXP.MatchString(names)) {
+			if text := collapseSpaces(textContent(n)); text != "" && len(text) < 100 {
+				e.byline = text
+				removed = append(removed, n)
+				return false
+			}
+		}
+		if n.DataAtom != atom.Body && n.DataAtom != atom.A && n.DataAtom != atom.Html &&
+			UNLIKELY_CANDIDATES_REGEXP.MatchString(names) && !MAYBE_CANDIDATE_REGEXP.MatchString(names) {
+			removed = append(removed, n)
+			return false
+		}
+		return true
+	})
+	for _, n := range removed {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+// topCandidate scores the ancestors of the paragraphs and returns the best one.
+func (e *extractor) topCandidate(doc *html.Node) *html.Node {
+	var candidates []*html.Node
+	walk(doc, func(n *html.Node) bool {
+		if n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td {
+			return true
+		}
+		text := collapseSpaces(textContent(n))
+		if len(text) < MIN_PARAGRAPH_LENGTH {
+			return false
+		}
+		score := 1 + float64(len(COMMA_REGEXP.FindAllStringIndex(text, -1))) + math.Min(float64(len(text))/100, 3)
+		// the parent gets the whole score, the grandparent half of it, the next ancestor a sixth
+		for level, ancestor := 0, n.Parent; level < 3 && ancestor != nil && ancestor.Type == html.ElementNode; level, ancestor = level+1, ancestor.Parent {
+			if _, found := e.scores[ancestor]; !found {
+				e.scores[ancestor] = e.initialScore(ancestor)
+				candidates = append(candidates, ancestor)
+			}
+			switch level {
+			case 0:
+				e.scores[ancestor] += score
+			case 1:
+				e.scores[ancestor] += score / 2
+			default:
+				e.scores[ancestor] += score / float64(level*3)
+			}
+		}
+		return false
+	})
+
+	var top *html.Node
+	for _, n := range candidates {
+		// the links are not part of the article
+		e.scores[n] *= 1 - linkDensity(n)
+		if top == nil || e.scores[n] > e.scores[top] {
+			top = n
+		}
+	}
+	return top
+}
+
+// articleNodes returns the top candidate, and its siblings which look like a part of the article.
+func (e *extractor) articleNodes(top *html.Node) []*html.Node {
+	if top.Parent == nil || top.DataAtom == atom.Body {
+		return []*html.Node{top}
+	}
+	threshold := math.Max(10, e.scores[top]*0.2)
+	var nodes []*html.Node
+	for n := top.Parent.FirstChild; n != nil; n = n.NextSibling {
+		if n == top {
+			nodes = append(nodes, n)
+			continue
+		}
+		if n.Type != html.ElementNode {
+			continue
+		}
+		if score, found := e.scores[n]; found && score >= threshold {
+			nodes = append(nodes, n)
+			continue
+		}
+		if n.DataAtom == atom.P {
+			text := collapseSpaces(textContent(n))
+			density := linkDensity(n)
+			if (len(text) > 80 && density < 0.25) || (len(text) > 0 && density == 0 && strings.Contains(text, ". ")) {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	return nodes
+}
+
+func (e *extractor) initialScore(n *html.Node) float64 {
+	var score float64
+	switch n.DataAtom {
+	case atom.Article:
+		score = 10
+	case atom.Div:
+		score = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score = 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		score = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score = -5
+	}
+	for _, name := range []string{attr(n, "class"), attr(n, "id")} {
+		if name == "" {
+			continue
+		}
+		if NEGATIVE_REGEXP.MatchString(name) {
+			score -= 25
+		}
+		if POSITIVE_REGEXP.MatchString(name) {
+			score += 25
+		}
+	}
+	return score
+}
+
+// absoluteURLs resolves the URLs of the links and the images of n.
+func (e *extractor) absoluteURLs(n *html.Node) {
+	walk(n, func(n *html.Node) bool {
+		for i, a := range n.Attr {
+			switch a.Key {
+			case "href", "src", "poster":
+				n.Attr[i].Val = e.absoluteURL(a.Val)
+			}
+		}
+		return true
+	})
+}
+
+func (e *extractor) absoluteURL(uri string) string {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return ""
+	}
+	return e.baseURL.ResolveReference(u).String()
+}
+
+func firstImage(n *html.Node) string {
+	var src string
+	walk(n, func(n *html.Node) bool {
+		if src == "" && n.DataAtom == atom.Img {
+			src = attr(n, "src")
+		}
+		return src == ""
+	})
+	return src
+}
+
+// linkDensity is the ratio of the text of n which is in links.
+func linkDensity(n *html.Node) float64 {
+	length := len(textContent(n))
+	if length == 0 {
+		return 0
+	}
+	linkLength := 0
+	walk(n, func(n *html.Node) bool {
+		if n.DataAtom == atom.A {
+			linkLength += len(textContent(n))
+			return false
+		}
+		return true
+	})
+	return float64(linkLength) / float64(length)
+}
+
+// walk calls f on n and its descendants, in document order. The children of a node are skipped
+// when f returns false.
+func walk(n *html.Node, f func(n *html.Node) bool) {
+	if !f(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, f)
+	}
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(n *html.Node) bool {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		return true
+	})
+	return b.String()
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package reader
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var ARTICLE_HTML string = `<!doctype html>
+<html>
+<head>
+ <title>The article - Example news</title>
+ <meta property="og:image" content="/lead.jpg">
+</head>
+<body>
+ <div id="header"><a href="/">Home</a> <a href="/news">News</a> <a href="/sport">Sport</a></div>
+ <nav><ul><li><a href="/a">A</a></li><li><a href="/b">B</a></li></ul></nav>
+ <div class="main-content">
+  <h1>The article</h1>
+  <p class="byline">By Jane Doe</p>
+  <div class="article-body">
+   <p>The first paragraph of the article is long enough to be scored, with a few commas, words, and sentences.</p>
+   <p>The second paragraph has <a href="details">a link</a> to the details, and more text to read, again and again.</p>
+   <img src="figure.png" alt="figure">
+   <p>The third paragraph concludes the article, with a last sentence which is long enough to be kept.</p>
+  </div>
+ </div>
+ <div class="sidebar"><p>Subscribe to the newsletter, with commas, commas, commas and more commas everywhere.</p></div>
+ <div class="comments"><p>A comment which is long enough to be scored, but which is not part of the article.</p></div>
+ <footer><p>Copyright, all rights reserved, terms of use, privacy policy, cookies, contact us.</p></footer>
+ <script>track()</script>
+</body>
+</html>`
+
+func TestExtract(t *testing.T) {
+	u, _ := url.Parse("https://example.com/news/article")
+	article, err := Extract(strings.NewReader(ARTICLE_HTML), u)
+	if err != nil {
+		t.Fatalf("Article not found: %v", err)
+	}
+	if article.Title != "The article - Example news" {
+		t.Errorf(`Unexpected title. Expected: "The article - Example news", Got: "%s"`, article.Title)
+	}
+	if article.Byline != "By Jane Doe" {
+		t.Errorf(`Unexpected byline. Expected: "By Jane Doe", Got: "%s"`, article.Byline)
+	}
+	if article.Image != "https://example.com/lead.jpg" {
+		t.Errorf(`Unexpected lead image. Expected: "https://example.com/lead.jpg", Got: "%s"`, article.Image)
+	}
+	for _, expected := range []string{
+		"The first paragraph",
+		"The third paragraph",
+		`<a href="https://example.com/news/details">`,
+		`<img src="https://example.com/news/figure.png"`,
+	} {
+		if !strings.Contains(article.Content, expected) {
+			t.Errorf(`The article has no "%s": %s`, expected, article.Content)
+		}
+	}
+	for _, unexpected := range []string{"Home", "newsletter", "comment", "Copyright", "track()", "By Jane Doe"} {
+		if strings.Contains(article.Content, unexpected) {
+			t.Errorf(`The article has "%s": %s`, unexpected, article.Content)
+		}
+	}
+}
+
+func TestExtractNoArticle(t *testing.T) {
+	u, _ := url.Parse("https://example.com/")
+	doc := `<html><body><form><input name="q"></form><ul><li><a href="/a">A link</a></li></ul></body></html>`
+	if _, err := Extract(strings.NewReader(doc), u); err != ErrNoArticle {
+		t.Errorf("Unexpected article. Expected: %v, Got: %v", ErrNoArticle, err)
+	}
+}
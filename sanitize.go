@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+
+	"github.com/asciimoo/morty/policy"
+	"github.com/asciimoo/morty/sanitizer"
+)
+
+// SANITIZE_TYPES maps the file extensions to the document types of the sanitize command.
+var SANITIZE_TYPES map[string]string = map[string]string{
+	".css":   "css",
+	".htm":   "html",
+	".html":  "html",
+	".shtml": "html",
+}
+
+// errorCounter counts the messages of the sanitizer log.
+type errorCounter struct {
+	w     io.Writer
+	count int
+}
+
+func (c *errorCounter) Write(p []byte) (int, error) {
+	c.count++
+	return c.w.Write(p)
+}
+
+// runSanitizeCommand sanitizes the files given in args, or stdin, to stdout, and returns the exit
+// status: 1 when a document has errors, 2 when the command line is invalid.
+func runSanitizeCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("sanitize", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: morty sanitize [options] [file ...]")
+		fmt.Fprintln(stderr, "Sanitizes the files, or stdin, to stdout.")
+		flags.PrintDefaults()
+	}
+	baseURL := flags.String("base-url", "", "Absolute URL of the documents, which resolves their relative URLs - required by -rewrite proxy")
+	rewrite := flags.String("rewrite", "none", "URL rewriting: none keeps the URLs, proxy rewrites them to a morty proxy")
+	docType := flags.String("type", "", "Type of the documents: html or css - inferred from the file extension if blank, html for stdin")
+	prefix := flags.String("prefix", "", "URL of the morty proxy used by -rewrite proxy (default \"./\")")
+	key := flags.String("key", "", "HMAC url validation key (base64 encoded) of the morty proxy used by -rewrite proxy")
+	attributePolicy := flags.String("attributepolicy", "", "JSON file of the HTML attribute policy - leave blank to use the default policy")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	s, err := newCommandSanitizer(*baseURL, *rewrite, *prefix, *key, *attributePolicy)
+	if err != nil {
+		fmt.Fprintln(stderr, "morty sanitize:", err)
+		return 2
+	}
+	if *docType != "" && *docType != "html" && *docType != "css" {
+		fmt.Fprintln(stderr, "morty sanitize: unknown type", *docType)
+		return 2
+	}
+
+	// the sanitizer errors and the documents which can't be read are counted apart
+	report := &errorCounter{w: stderr}
+	readErrors := 0
+	readError := func(name string, err error) {
+		fmt.Fprintf(stderr, "%s: %v\n", name, err)
+		readErrors++
+	}
+	if flags.NArg() == 0 {
+		t := *docType
+		if t == "" {
+			t = "html"
+		}
+		s.ErrorLog = log.New(report, "stdin: ", 0)
+		if err := sanitizeDocument(s, t, stdout, stdin); err != nil {
+			readError("stdin", err)
+		}
+	}
+	for _, name := range flags.Args() {
+		s.ErrorLog = log.New(report, name+": ", 0)
+		t := *docType
+		if t == "" {
+			t = SANITIZE_TYPES[strings.ToLower(filepath.Ext(name))]
+		}
+		if t == "" {
+			readError(name, errors.New("unknown type, use -type"))
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			readError(name, err)
+			continue
+		}
+		err = sanitizeDocument(s, t, stdout, f)
+		f.Close()
+		if err != nil {
+			readError(name, err)
+		}
+	}
+
+	if report.count > 0 || readErrors > 0 {
+		fmt.Fprintf(stderr, "morty sanitize: %d error(s), %d unreadable document(s)\n", report.count, readErrors)
+		return 1
+	}
+	return 0
+}
+
+// newCommandSanitizer returns the sanitizer of the command. Without base URL, the relative URLs
+// are kept, which only -rewrite none allows.
+func newCommandSanitizer(baseURL, rewrite, prefix, key, attributePolicy string) (*sanitizer.Sanitizer, error) {
+	var u *url.URL
+	var err error
+	if baseURL != "" || rewrite != "none" {
+		if u, err = url.Parse(baseURL); err != nil {
+			return nil, err
+		}
+		if !u.IsAbs() {
+			return nil, errors.New("-base-url must be an absolute URL")
+		}
+	}
+	s := sanitizer.New(u, nil)
+	switch rewrite {
+	case "none":
+		s.Rewriter = sanitizer.URLRewriterFunc(func(u *url.URL) (string, error) {
+			return u.String(), nil
+		})
+	case "proxy":
+		rewriter := &sanitizer.ProxyRewriter{Prefix: prefix}
+		if key != "" {
+			if rewriter.Key, err = base64.StdEncoding.DecodeString(key); err != nil {
+				return nil, err
+			}
+		}
+		s.Rewriter = rewriter
+	default:
+		return nil, errors.New("unknown rewrite mode " + rewrite)
+	}
+	if attributePolicy != "" {
+		if s.Policy, err = policy.LoadFile(attributePolicy); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// sanitizeDocument converts the document read from r to UTF-8 and writes the sanitized document
+// to w.
+func sanitizeDocument(s *sanitizer.Sanitizer, docType string, w io.Writer, r io.Reader) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	e, ename, _ := charset.DetermineEncoding(body, "text/"+docType)
+	if (e != encoding.Nop) && (!strings.EqualFold("utf-8", ename)) {
+		body, err = e.NewDecoder().Bytes(body)
+		if err != nil {
+			return err
+		}
+	}
+	if docType == "css" {
+		return s.CSS(w, bytes.NewReader(body))
+	}
+	return s.HTML(w, bytes.NewReader(body))
+}
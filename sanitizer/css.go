@@ -0,0 +1,48 @@
+package sanitizer
+
+import (
+	"io"
+	"io/ioutil"
+	"regexp"
+)
+
+var CSS_URL_REGEXP *regexp.Regexp = regexp.MustCompile("url\\((['\"]?)[ \\t\\f]*([\u0009\u0021\u0023-\u0026\u0028\u002a-\u007E]+)(['\"]?)\\)?")
+
+// CSS reads a CSS document from r and writes the document with rewritten URLs to w.
+func (s *Sanitizer) CSS(w io.Writer, r io.Reader) error {
+	css, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.sanitizeCSS(w, css)
+	return nil
+}
+
+func (s *Sanitizer) sanitizeCSS(out io.Writer, css []byte) {
+	// TODO
+
+	urlSlices := CSS_URL_REGEXP.FindAllSubmatchIndex(css, -1)
+
+	if urlSlices == nil {
+		out.Write(css)
+		return
+	}
+
+	startIndex := 0
+
+	for _, u := range urlSlices {
+		urlStart := u[4]
+		urlEnd := u[5]
+
+		if uri, err := s.rewriteURI(css[urlStart:urlEnd]); err == nil {
+			out.Write(css[startIndex:urlStart])
+			out.Write([]byte(uri))
+			startIndex = urlEnd
+		} else {
+			s.logf("cannot proxify css uri: %s", css[urlStart:urlEnd])
+		}
+	}
+	if startIndex < len(css) {
+		out.Write(css[startIndex:len(css)])
+	}
+}
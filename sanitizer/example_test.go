@@ -0,0 +1,58 @@
+package sanitizer_test
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/asciimoo/morty/sanitizer"
+)
+
+func ExampleSanitizer_HTML() {
+	baseURL, _ := url.Parse("https://example.com/page")
+	s := sanitizer.New(baseURL, &sanitizer.ProxyRewriter{Prefix: "https://proxy.example.org/"})
+
+	doc := `<p onclick="steal()">Hello <a href="/about">about</a></p><script>steal()</script>`
+	s.HTML(os.Stdout, strings.NewReader(doc))
+	// Output:
+	// <p>Hello <a href="https://proxy.example.org/?mortyurl=https%3A%2F%2Fexample.com%2Fabout">about</a></p>
+}
+
+func ExampleSanitizer_CSS() {
+	baseURL, _ := url.Parse("https://example.com/css/main.css")
+	s := sanitizer.New(baseURL, &sanitizer.ProxyRewriter{Key: []byte("secret")})
+
+	s.CSS(os.Stdout, strings.NewReader(`body { background: url(../bg.png) }`))
+	// Output:
+	// body { background: url(./?mortyhash=659a541bef000cdd39343fa66cacde5b9994daf1bb8f92bb6147df8722096d04&mortyurl=https%3A%2F%2Fexample.com%2Fbg.png) }
+}
+
+func ExampleSanitizer_URL() {
+	baseURL, _ := url.Parse("https://example.com/a/")
+	s := sanitizer.New(baseURL, &sanitizer.ProxyRewriter{})
+
+	for _, uri := range []string{"b?c=d", "#top", "javascript:alert(1)"} {
+		rewritten, _ := s.URL(uri)
+		fmt.Printf("%q\n", rewritten)
+	}
+	// Output:
+	// "./?mortyurl=https%3A%2F%2Fexample.com%2Fa%2Fb%3Fc%3Dd"
+	// "#top"
+	// ""
+}
+
+func ExampleURLRewriterFunc() {
+	baseURL, _ := url.Parse("https://example.com/")
+	// keep the links of the page, and serve the images of the other hosts from a CDN
+	s := sanitizer.New(baseURL, &sanitizer.SameOriginRewriter{
+		Origin: baseURL,
+		Next: sanitizer.URLRewriterFunc(func(u *url.URL) (string, error) {
+			return "https://cdn.example.org/" + u.Host + u.EscapedPath(), nil
+		}),
+	})
+
+	s.HTML(os.Stdout, strings.NewReader(`<a href="/news"><img src="https://img.example.net/logo.png" /></a>`))
+	// Output:
+	// <a href="https://example.com/news"><img src="https://cdn.example.org/img.example.net/logo.png" /></a>
+}
@@ -0,0 +1,117 @@
+package sanitizer
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// URLRewriterFunc adapts a function to the URLRewriter interface.
+type URLRewriterFunc func(u *url.URL) (string, error)
+
+func (f URLRewriterFunc) RewriteURL(u *url.URL) (string, error) {
+	return f(u)
+}
+
+// PathRewriter rewrites the URLs to a proxy which reads the target URL from the path:
+// Prefix, the signature of the URL if Key is set, the scheme, the host and the path, followed by
+// the query of the URL. For example https://example.com/a?b=c is rewritten to
+// https://proxy.example.org/https/example.com/a?b=c with the Prefix https://proxy.example.org/.
+//
+// The query is not signed, so GET forms need no hidden input: the browser replaces the query of
+// the action with the form fields.
+type PathRewriter struct {
+	// Prefix is the URL of the proxy, ending with a slash.
+	Prefix string
+	// Key signs the URLs. Nil disables the signature.
+	Key []byte
+}
+
+func (p *PathRewriter) RewriteURL(u *url.URL) (string, error) {
+	if u.Scheme == "" || u.Host == "" {
+		return "", errors.New("not an absolute URL")
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	target := u.Scheme + "/" + u.Host + path
+	if p.Key != nil {
+		target = Hash(u.Scheme+"://"+u.Host+path, p.Key) + "/" + target
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	return p.Prefix + target, nil
+}
+
+// TargetURL returns the URL rewritten to path, the escaped path following the Prefix, and
+// rawQuery. The signature is checked if Key is set.
+func (p *PathRewriter) TargetURL(path, rawQuery string) (*url.URL, error) {
+	var hash string
+	if p.Key != nil {
+		i := strings.IndexByte(path, '/')
+		if i == -1 {
+			return nil, errors.New("missing signature")
+		}
+		hash, path = path[:i], path[i+1:]
+	}
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) < 2 || (parts[0] != "http" && parts[0] != "https") || parts[1] == "" {
+		return nil, errors.New("invalid target URL")
+	}
+	urlStr := parts[0] + "://" + parts[1] + "/"
+	if len(parts) == 3 {
+		urlStr += parts[2]
+	}
+	if p.Key != nil {
+		h, err := hex.DecodeString(hash)
+		if err != nil || !hmac.Equal(h, hashBytes(urlStr, p.Key)) {
+			return nil, errors.New("invalid signature")
+		}
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = rawQuery
+	return u, nil
+}
+
+// SameOriginRewriter keeps the URLs of the Origin scheme and host, and rewrites the other URLs
+// with Next.
+type SameOriginRewriter struct {
+	Origin *url.URL
+	Next   URLRewriter
+}
+
+func (r *SameOriginRewriter) RewriteURL(u *url.URL) (string, error) {
+	if r.sameOrigin(u) {
+		return u.String(), nil
+	}
+	return r.Next.RewriteURL(u)
+}
+
+// FormInputs returns the inputs of Next for the forms of the other origins.
+func (r *SameOriginRewriter) FormInputs(action *url.URL, method string) []FormInput {
+	formRewriter, ok := r.Next.(FormRewriter)
+	if !ok || r.sameOrigin(action) {
+		return nil
+	}
+	return formRewriter.FormInputs(action, method)
+}
+
+// SubmitterName returns the name of Next for the form actions of the other origins.
+func (r *SameOriginRewriter) SubmitterName(action *url.URL, name string) (string, bool) {
+	formRewriter, ok := r.Next.(FormRewriter)
+	if !ok || r.sameOrigin(action) {
+		return "", false
+	}
+	return formRewriter.SubmitterName(action, name)
+}
+
+func (r *SameOriginRewriter) sameOrigin(u *url.URL) bool {
+	return strings.EqualFold(u.Scheme, r.Origin.Scheme) && strings.EqualFold(u.Host, r.Origin.Host)
+}
@@ -0,0 +1,533 @@
+// Package sanitizer removes the scripts and the other unsafe content of HTML and CSS documents,
+// and rewrites their URLs with an URLRewriter.
+//
+// It is the sanitizer of the morty proxy: ProxyRewriter rewrites the URLs to the proxy.
+package sanitizer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/asciimoo/morty/policy"
+)
+
+const (
+	STATE_DEFAULT     int = 0
+	STATE_IN_STYLE    int = 1
+	STATE_IN_NOSCRIPT int = 2
+)
+
+// UNSAFE_ELEMENTS are removed with their content.
+var UNSAFE_ELEMENTS [][]byte = [][]byte{
+	[]byte("applet"),
+	[]byte("canvas"),
+	[]byte("embed"),
+	//[]byte("iframe"),
+	[]byte("math"),
+	[]byte("script"),
+	[]byte("svg"),
+}
+
+var FORM_ENCTYPE_SAFE_VALUES [][]byte = [][]byte{
+	[]byte("application/x-www-form-urlencoded"),
+	[]byte("multipart/form-data"),
+	[]byte("text/plain"),
+}
+
+var FORM_METHOD_SAFE_VALUES [][]byte = [][]byte{
+	[]byte("dialog"),
+	[]byte("get"),
+	[]byte("post"),
+}
+
+// IFRAME_SANDBOX_POLICIES are the sandbox tokens set on iframes, from the strictest policy to the
+// most permissive one. Scripts are removed by the sanitizer, so allow-scripts is never needed.
+var IFRAME_SANDBOX_POLICIES map[string]string = map[string]string{
+	"strict":     "",
+	"forms":      "allow-forms",
+	"permissive": "allow-forms allow-popups allow-popups-to-escape-sandbox allow-same-origin",
+}
+
+var LINK_REL_SAFE_VALUES [][]byte = [][]byte{
+	[]byte("alternate"),
+	[]byte("archives"),
+	[]byte("author"),
+	[]byte("copyright"),
+	[]byte("first"),
+	[]byte("help"),
+	[]byte("icon"),
+	[]byte("index"),
+	[]byte("last"),
+	[]byte("license"),
+	[]byte("manifest"),
+	[]byte("next"),
+	[]byte("pingback"),
+	[]byte("prev"),
+	[]byte("publisher"),
+	[]byte("search"),
+	[]byte("shortcut icon"),
+	[]byte("stylesheet"),
+	[]byte("up"),
+}
+
+var LINK_HTTP_EQUIV_SAFE_VALUES [][]byte = [][]byte{
+	// X-UA-Compatible will be added automaticaly, so it can be skipped
+	[]byte("date"),
+	[]byte("last-modified"),
+	[]byte("refresh"), // URL rewrite
+	// []byte("location"), TODO URL rewrite
+	[]byte("content-language"),
+}
+
+// Sanitizer sanitizes the documents of one base URL. The zero values of the optional fields are
+// the safest settings.
+type Sanitizer struct {
+	// BaseURL is the URL of the document. A <base> element overrides it while the document is
+	// sanitized. If nil, the relative URLs are given as is to the Rewriter.
+	BaseURL *url.URL
+	// Rewriter rewrites the URLs of the document, a ProxyRewriter without key if nil.
+	Rewriter URLRewriter
+	// Policy lists the allowed attributes, policy.DEFAULT if nil.
+	Policy *policy.Policy
+	// IframeSandbox lists the sandbox tokens allowed on iframes. See IFRAME_SANDBOX_POLICIES.
+	IframeSandbox string
+	// BlockIframes removes the iframes with their content.
+	BlockIframes bool
+	// HeadExtension is written after the <head> start tag.
+	HeadExtension func(w io.Writer)
+	// BodyExtension is written before the </body> end tag, or at the end of a document without
+	// body. It is not written in the srcdoc of iframes.
+	BodyExtension func(w io.Writer)
+	// ErrorLog logs the URLs which can't be rewritten. Nothing is logged if nil.
+	ErrorLog *log.Logger
+
+	bodyExtensionWritten bool
+}
+
+// New returns a Sanitizer for the documents of baseURL.
+func New(baseURL *url.URL, rewriter URLRewriter) *Sanitizer {
+	return &Sanitizer{BaseURL: baseURL, Rewriter: rewriter}
+}
+
+// HTML reads an UTF-8 HTML document from r and writes the sanitized document to w.
+func (s *Sanitizer) HTML(w io.Writer, r io.Reader) error {
+	// the document state, like the base URL, is not kept between documents
+	d := *s
+	d.bodyExtensionWritten = false
+	err := d.sanitizeHTML(w, r)
+	if !d.bodyExtensionWritten && d.BodyExtension != nil {
+		d.BodyExtension(w)
+	}
+	return err
+}
+
+func (s *Sanitizer) logf(format string, v ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, v...)
+	}
+}
+
+func (s *Sanitizer) rewriter() URLRewriter {
+	if s.Rewriter == nil {
+		return &ProxyRewriter{}
+	}
+	return s.Rewriter
+}
+
+func (s *Sanitizer) policy() *policy.Policy {
+	if s.Policy == nil {
+		return policy.DEFAULT
+	}
+	return s.Policy
+}
+
+func (s *Sanitizer) sanitizeHTML(out io.Writer, r io.Reader) error {
+	decoder := html.NewTokenizer(r)
+	decoder.AllowCDATA(true)
+
+	unsafeElements := make([][]byte, 0, 8)
+	state := STATE_DEFAULT
+	for {
+		token := decoder.Next()
+		if token == html.ErrorToken {
+			err := decoder.Err()
+			if err != io.EOF {
+				return err
+			}
+			return nil
+		}
+
+		if len(unsafeElements) == 0 {
+
+			switch token {
+			case html.StartTagToken, html.SelfClosingTagToken:
+				tag, hasAttrs := decoder.TagName()
+				safe := !s.unsafeElement(tag)
+				if !safe {
+					if token != html.SelfClosingTagToken {
+						var unsafeTag []byte = make([]byte, len(tag))
+						copy(unsafeTag, tag)
+						unsafeElements = append(unsafeElements, unsafeTag)
+					}
+					break
+				}
+				if bytes.Equal(tag, []byte("base")) {
+					for {
+						attrName, attrValue, moreAttr := decoder.TagAttr()
+						if bytes.Equal(attrName, []byte("href")) {
+							parsedURI, err := url.Parse(string(attrValue))
+							if err == nil {
+								s.BaseURL = parsedURI
+							}
+						}
+						if !moreAttr {
+							break
+						}
+					}
+					break
+				}
+				if bytes.Equal(tag, []byte("noscript")) {
+					state = STATE_IN_NOSCRIPT
+					break
+				}
+				var attrs [][][]byte
+				if hasAttrs {
+					for {
+						attrName, attrValue, moreAttr := decoder.TagAttr()
+						attrs = append(attrs, [][]byte{
+							attrName,
+							attrValue,
+							[]byte(html.EscapeString(string(attrValue))),
+						})
+						if !moreAttr {
+							break
+						}
+					}
+				}
+				if bytes.Equal(tag, []byte("link")) {
+					s.sanitizeLinkTag(out, attrs, ">")
+					break
+				}
+
+				if bytes.Equal(tag, []byte("meta")) {
+					s.sanitizeMetaTag(out, attrs, ">")
+					break
+				}
+
+				fmt.Fprintf(out, "<%s", tag)
+
+				if bytes.Equal(tag, []byte("iframe")) {
+					// the sandbox attribute is always written
+					s.sanitizeIframeAttrs(out, attrs)
+				} else if hasAttrs {
+					if bytes.Equal(tag, []byte("button")) || bytes.Equal(tag, []byte("input")) {
+						s.sanitizeSubmitterAttrs(out, tag, attrs)
+					} else {
+						s.sanitizeAttrs(out, tag, attrs)
+					}
+				}
+
+				if token == html.SelfClosingTagToken {
+					fmt.Fprintf(out, " />")
+				} else {
+					fmt.Fprintf(out, ">")
+					if bytes.Equal(tag, []byte("style")) {
+						state = STATE_IN_STYLE
+					}
+				}
+
+				if bytes.Equal(tag, []byte("head")) && s.HeadExtension != nil {
+					s.HeadExtension(out)
+				}
+
+				if bytes.Equal(tag, []byte("form")) {
+					s.writeFormInputs(out, attrs)
+				}
+
+			case html.EndTagToken:
+				tag, _ := decoder.TagName()
+				writeEndTag := true
+				switch string(tag) {
+				case "body":
+					if s.BodyExtension != nil {
+						s.BodyExtension(out)
+						s.bodyExtensionWritten = true
+					}
+				case "style":
+					state = STATE_DEFAULT
+				case "noscript":
+					state = STATE_DEFAULT
+					writeEndTag = false
+				}
+				// skip noscript tags - only the tag, not the content, because javascript is sanitized
+				if writeEndTag {
+					fmt.Fprintf(out, "</%s>", tag)
+				}
+
+			case html.TextToken:
+				switch state {
+				case STATE_DEFAULT:
+					fmt.Fprintf(out, "%s", decoder.Raw())
+				case STATE_IN_STYLE:
+					s.sanitizeCSS(out, decoder.Raw())
+				case STATE_IN_NOSCRIPT:
+					s.sanitizeHTML(out, bytes.NewReader(decoder.Raw()))
+				}
+
+			case html.CommentToken:
+				// ignore comment. TODO : parse IE conditional comment
+
+			case html.DoctypeToken:
+				out.Write(decoder.Raw())
+			}
+		} else {
+			switch token {
+			case html.StartTagToken, html.SelfClosingTagToken:
+				tag, _ := decoder.TagName()
+				if s.unsafeElement(tag) {
+					unsafeElements = append(unsafeElements, tag)
+				}
+
+			case html.EndTagToken:
+				tag, _ := decoder.TagName()
+				if bytes.Equal(unsafeElements[len(unsafeElements)-1], tag) {
+					unsafeElements = unsafeElements[:len(unsafeElements)-1]
+				}
+			}
+		}
+	}
+}
+
+func (s *Sanitizer) unsafeElement(tag []byte) bool {
+	return inArray(tag, UNSAFE_ELEMENTS) || (s.BlockIframes && bytes.Equal(tag, []byte("iframe")))
+}
+
+// writeFormInputs writes the hidden inputs of the URL rewriter after a <form> start tag.
+func (s *Sanitizer) writeFormInputs(out io.Writer, attrs [][][]byte) {
+	formRewriter, ok := s.rewriter().(FormRewriter)
+	if !ok {
+		return
+	}
+	var formURL *url.URL
+	method := "get"
+	for _, attr := range attrs {
+		switch string(attr[0]) {
+		case "action":
+			if formURL == nil {
+				formURL, _ = url.Parse(string(attr[1]))
+				formURL = mergeURIs(s.BaseURL, formURL)
+			}
+		case "method":
+			method = strings.ToLower(strings.TrimSpace(string(attr[1])))
+		}
+	}
+	if formURL == nil {
+		formURL = s.BaseURL
+	}
+	for _, input := range formRewriter.FormInputs(formURL, method) {
+		fmt.Fprintf(out, `<input type="hidden" name="%s" value="%s" />`, html.EscapeString(input.Name), html.EscapeString(input.Value))
+	}
+}
+
+// sanitizeLinkTag writes a <link> tag ended by end, unless its rel or as attribute is unsafe.
+func (s *Sanitizer) sanitizeLinkTag(out io.Writer, attrs [][][]byte, end string) {
+	exclude := false
+	for _, attr := range attrs {
+		attrName := attr[0]
+		attrValue := attr[1]
+		if bytes.Equal(attrName, []byte("rel")) {
+			if !inArray(attrValue, LINK_REL_SAFE_VALUES) {
+				exclude = true
+				break
+			}
+		}
+		if bytes.Equal(attrName, []byte("as")) {
+			if bytes.Equal(attrValue, []byte("script")) {
+				exclude = true
+				break
+			}
+		}
+	}
+
+	if !exclude {
+		out.Write([]byte("<link"))
+		s.sanitizeAttrs(out, []byte("link"), attrs)
+		io.WriteString(out, end)
+	}
+}
+
+// sanitizeMetaTag writes a <meta> tag ended by end, unless its http-equiv attribute is unsafe.
+func (s *Sanitizer) sanitizeMetaTag(out io.Writer, attrs [][][]byte, end string) {
+	var http_equiv []byte
+	var content []byte
+
+	for _, attr := range attrs {
+		attrName := attr[0]
+		attrValue := attr[1]
+		if bytes.Equal(attrName, []byte("http-equiv")) {
+			http_equiv = bytes.ToLower(attrValue)
+			// exclude some <meta http-equiv="..." ..>
+			if !inArray(http_equiv, LINK_HTTP_EQUIV_SAFE_VALUES) {
+				return
+			}
+		}
+		if bytes.Equal(attrName, []byte("content")) {
+			content = attrValue
+		}
+		if bytes.Equal(attrName, []byte("charset")) {
+			// exclude <meta charset="...">
+			return
+		}
+	}
+
+	out.Write([]byte("<meta"))
+	urlIndex := bytes.Index(bytes.ToLower(content), []byte("url="))
+	if bytes.Equal(http_equiv, []byte("refresh")) && urlIndex != -1 {
+		contentUrl := content[urlIndex+4:]
+		// special case of <meta http-equiv="refresh" content="0; url='example.com/url.with.quote.outside'">
+		if len(contentUrl) >= 2 && (contentUrl[0] == byte('\'') || contentUrl[0] == byte('"')) {
+			if contentUrl[0] == contentUrl[len(contentUrl)-1] {
+				contentUrl = contentUrl[1 : len(contentUrl)-1]
+			}
+		}
+		// output proxify result
+		if uri, err := s.rewriteURI(contentUrl); err == nil {
+			fmt.Fprintf(out, ` http-equiv="refresh" content="%surl=%s"`, html.EscapeString(string(content[:urlIndex])), html.EscapeString(uri))
+		}
+	} else {
+		if len(http_equiv) > 0 {
+			fmt.Fprintf(out, ` http-equiv="%s"`, http_equiv)
+		}
+		s.sanitizeAttrs(out, []byte("meta"), attrs)
+	}
+	io.WriteString(out, end)
+}
+
+func (s *Sanitizer) sanitizeAttrs(out io.Writer, tag []byte, attrs [][][]byte) {
+	for _, attr := range attrs {
+		s.sanitizeAttr(out, tag, attr[0], attr[1], attr[2])
+	}
+}
+
+// sanitizeIframeAttrs writes the attributes of an <iframe>. The sandbox attribute keeps the tokens
+// of the page which are allowed by the policy, and is added when the page doesn't set it. The
+// srcdoc document is sanitized like the page, without the body extension.
+func (s *Sanitizer) sanitizeIframeAttrs(out io.Writer, attrs [][][]byte) {
+	sandbox := s.IframeSandbox
+	for _, attr := range attrs {
+		switch string(attr[0]) {
+		case "sandbox":
+			sandbox = filterSandboxTokens(string(attr[1]), s.IframeSandbox)
+		case "srcdoc":
+			srcdocSanitizer := *s
+			srcdocSanitizer.BodyExtension = nil
+			srcdoc := bytes.NewBuffer(nil)
+			srcdocSanitizer.HTML(srcdoc, bytes.NewReader(attr[1]))
+			fmt.Fprintf(out, " srcdoc=\"%s\"", html.EscapeString(srcdoc.String()))
+		default:
+			s.sanitizeAttr(out, []byte("iframe"), attr[0], attr[1], attr[2])
+		}
+	}
+	fmt.Fprintf(out, " sandbox=\"%s\"", sandbox)
+}
+
+// filterSandboxTokens returns the tokens of sandbox which are also in allowed.
+func filterSandboxTokens(sandbox, allowed string) string {
+	allowedTokens := strings.Fields(allowed)
+	var tokens []string
+	for _, token := range strings.Fields(strings.ToLower(sandbox)) {
+		for _, allowedToken := range allowedTokens {
+			if token == allowedToken {
+				tokens = append(tokens, token)
+				break
+			}
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+// sanitizeSubmitterAttrs writes the attributes of a <button> or an <input>. The rewritten
+// formaction may keep the target URL in its query, which the browser drops when it submits a GET
+// form. The submit buttons and the submit and image inputs send their name instead, so the
+// FormRewriter can rename them.
+func (s *Sanitizer) sanitizeSubmitterAttrs(out io.Writer, tag []byte, attrs [][][]byte) {
+	var formAction []byte
+	var name string
+	submitterType := "submit"
+	if bytes.Equal(tag, []byte("input")) {
+		submitterType = "text"
+	}
+	for _, attr := range attrs {
+		switch string(attr[0]) {
+		case "formaction":
+			formAction = attr[1]
+		case "name":
+			name = string(attr[1])
+		case "type":
+			submitterType = strings.ToLower(strings.TrimSpace(string(attr[1])))
+		}
+	}
+	submitterName, ok := "", false
+	if submitterType == "submit" || (submitterType == "image" && bytes.Equal(tag, []byte("input"))) {
+		submitterName, ok = s.submitterName(formAction, name)
+	}
+	if !ok {
+		s.sanitizeAttrs(out, tag, attrs)
+		return
+	}
+	for _, attr := range attrs {
+		if !bytes.Equal(attr[0], []byte("name")) {
+			s.sanitizeAttr(out, tag, attr[0], attr[1], attr[2])
+		}
+	}
+	fmt.Fprintf(out, " name=\"%s\"", html.EscapeString(submitterName))
+}
+
+// sanitizeAttr writes the attribute if the policy allows it on the element. The URLs and the style
+// are rewritten, and the values of some form attributes are checked.
+func (s *Sanitizer) sanitizeAttr(out io.Writer, tag, attrName, attrValue, escapedAttrValue []byte) {
+	p := s.policy()
+	if p.URL(tag, attrName) {
+		if uri, err := s.rewriteURI(attrValue); err == nil {
+			fmt.Fprintf(out, " %s=\"%s\"", attrName, html.EscapeString(uri))
+		} else {
+			s.logf("cannot proxify uri: %s", attrValue)
+		}
+		return
+	}
+	if bytes.Equal(attrName, []byte("style")) {
+		cssAttr := bytes.NewBuffer(nil)
+		s.sanitizeCSS(cssAttr, attrValue)
+		fmt.Fprintf(out, " %s=\"%s\"", attrName, html.EscapeString(string(cssAttr.Bytes())))
+		return
+	}
+	if !p.Allowed(tag, attrName) {
+		return
+	}
+	switch string(attrName) {
+	case "formmethod":
+		if !inArray(bytes.ToLower(bytes.TrimSpace(attrValue)), FORM_METHOD_SAFE_VALUES) {
+			return
+		}
+	case "enctype", "formenctype":
+		if !inArray(bytes.ToLower(bytes.TrimSpace(attrValue)), FORM_ENCTYPE_SAFE_VALUES) {
+			return
+		}
+	}
+	fmt.Fprintf(out, " %s=\"%s\"", attrName, escapedAttrValue)
+}
+
+func inArray(b []byte, a [][]byte) bool {
+	for _, b2 := range a {
+		if bytes.Equal(b, b2) {
+			return true
+		}
+	}
+	return false
+}
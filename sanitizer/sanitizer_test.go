@@ -0,0 +1,625 @@
+package sanitizer
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type AttrTestCase struct {
+	Element        []byte
+	AttrName       []byte
+	AttrValue      []byte
+	ExpectedOutput []byte
+}
+
+type SanitizeURITestCase struct {
+	Input          []byte
+	ExpectedOutput []byte
+	ExpectedScheme string
+}
+
+type StringTestCase struct {
+	Input          string
+	ExpectedOutput string
+}
+
+var attrTestData []*AttrTestCase = []*AttrTestCase{
+	&AttrTestCase{
+		[]byte("a"),
+		[]byte("href"),
+		[]byte(`#"><script>`),
+		[]byte(` href="#&#34;&gt;&lt;script&gt;"`),
+	},
+	&AttrTestCase{
+		[]byte("a"),
+		[]byte("href"),
+		[]byte("./x"),
+		[]byte(` href="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fx"`),
+	},
+	&AttrTestCase{
+		[]byte("img"),
+		[]byte("src"),
+		[]byte("http://x.com/y"),
+		[]byte(` src="./?mortyurl=http%3A%2F%2Fx.com%2Fy"`),
+	},
+	&AttrTestCase{
+		[]byte("frame"),
+		[]byte("src"),
+		[]byte("/menu"),
+		[]byte(` src="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fmenu"`),
+	},
+	&AttrTestCase{
+		[]byte("image"),
+		[]byte("src"),
+		[]byte("http://x.com/y"),
+		[]byte(` src="./?mortyurl=http%3A%2F%2Fx.com%2Fy"`),
+	},
+	&AttrTestCase{
+		[]byte("form"),
+		[]byte("action"),
+		[]byte("/z"),
+		[]byte(` action="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fz"`),
+	},
+	&AttrTestCase{
+		[]byte("form"),
+		[]byte("enctype"),
+		[]byte("multipart/form-data"),
+		[]byte(` enctype="multipart/form-data"`),
+	},
+	&AttrTestCase{
+		[]byte("form"),
+		[]byte("enctype"),
+		[]byte("application/json"),
+		nil,
+	},
+	&AttrTestCase{
+		[]byte("button"),
+		[]byte("formaction"),
+		[]byte("/search"),
+		[]byte(` formaction="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fsearch"`),
+	},
+	&AttrTestCase{
+		[]byte("button"),
+		[]byte("formmethod"),
+		[]byte("POST"),
+		[]byte(` formmethod="POST"`),
+	},
+	&AttrTestCase{
+		[]byte("button"),
+		[]byte("formenctype"),
+		[]byte("text/plain"),
+		[]byte(` formenctype="text/plain"`),
+	},
+	&AttrTestCase{
+		[]byte("input"),
+		[]byte("form"),
+		[]byte("search-form"),
+		[]byte(` form="search-form"`),
+	},
+	&AttrTestCase{
+		[]byte("div"),
+		[]byte("href"),
+		[]byte("/x"),
+		nil,
+	},
+	&AttrTestCase{
+		[]byte("div"),
+		[]byte("value"),
+		[]byte("x"),
+		nil,
+	},
+	&AttrTestCase{
+		[]byte("blockquote"),
+		[]byte("cite"),
+		[]byte("/source"),
+		[]byte(` cite="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fsource"`),
+	},
+	&AttrTestCase{
+		[]byte("img"),
+		[]byte("usemap"),
+		[]byte("#map"),
+		[]byte(` usemap="#map"`),
+	},
+	&AttrTestCase{
+		[]byte("td"),
+		[]byte("background"),
+		[]byte("/bg.png"),
+		[]byte(` background="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fbg.png"`),
+	},
+	&AttrTestCase{
+		[]byte("div"),
+		[]byte("onclick"),
+		[]byte("console.log(document.cookies)"),
+		nil,
+	},
+}
+
+var sanitizeUriTestData []*SanitizeURITestCase = []*SanitizeURITestCase{
+	&SanitizeURITestCase{
+		[]byte("http://example.com/"),
+		[]byte("http://example.com/"),
+		"http:",
+	},
+	&SanitizeURITestCase{
+		[]byte("HtTPs://example.com/     \t"),
+		[]byte("https://example.com/"),
+		"https:",
+	},
+	&SanitizeURITestCase{
+		[]byte("      Ht  TPs://example.com/     \t"),
+		[]byte("https://example.com/"),
+		"https:",
+	},
+	&SanitizeURITestCase{
+		[]byte("javascript:void(0)"),
+		[]byte("javascript:void(0)"),
+		"javascript:",
+	},
+	&SanitizeURITestCase{
+		[]byte("      /path/to/a/file/without/protocol     "),
+		[]byte("/path/to/a/file/without/protocol"),
+		"",
+	},
+	&SanitizeURITestCase{
+		[]byte("      #fragment     "),
+		[]byte("#fragment"),
+		"",
+	},
+	&SanitizeURITestCase{
+		[]byte("      qwertyuiop     "),
+		[]byte("qwertyuiop"),
+		"",
+	},
+	&SanitizeURITestCase{
+		[]byte(""),
+		[]byte(""),
+		"",
+	},
+	&SanitizeURITestCase{
+		[]byte(":"),
+		[]byte(":"),
+		":",
+	},
+	&SanitizeURITestCase{
+		[]byte("   :"),
+		[]byte(":"),
+		":",
+	},
+	&SanitizeURITestCase{
+		[]byte("schéma:"),
+		[]byte("schéma:"),
+		"schéma:",
+	},
+}
+
+var urlTestData []*StringTestCase = []*StringTestCase{
+	&StringTestCase{
+		"http://x.com/",
+		"./?mortyurl=http%3A%2F%2Fx.com%2F",
+	},
+	&StringTestCase{
+		"http://a@x.com/",
+		"./?mortyurl=http%3A%2F%2Fa%40x.com%2F",
+	},
+	&StringTestCase{
+		"#a",
+		"#a",
+	},
+}
+
+func TestAttrSanitizer(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1/")
+	s := New(u, &ProxyRewriter{})
+	for _, testCase := range attrTestData {
+		out := bytes.NewBuffer(nil)
+		s.sanitizeAttr(out, testCase.Element, testCase.AttrName, testCase.AttrValue, testCase.AttrValue)
+		res, _ := out.ReadBytes(byte(0))
+		if !bytes.Equal(res, testCase.ExpectedOutput) {
+			t.Errorf(
+				`Attribute parse error. Element: "%s", Name: "%s", Value: "%s", Expected: %s, Got: "%s"`,
+				testCase.Element,
+				testCase.AttrName,
+				testCase.AttrValue,
+				testCase.ExpectedOutput,
+				res,
+			)
+		}
+	}
+}
+
+var buttonTestData []*StringTestCase = []*StringTestCase{
+	&StringTestCase{
+		`<button formaction="/b" value="x">B</button>`,
+		`<button formaction="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fb" value="x" name="mortyformaction:mortyurl=http%3A%2F%2F127.0.0.1%2Fb:">B</button>`,
+	},
+	&StringTestCase{
+		`<button form="f" name="n" value="v" formaction="/b">B</button>`,
+		`<button form="f" value="v" formaction="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fb" name="mortyformaction:mortyurl=http%3A%2F%2F127.0.0.1%2Fb:n">B</button>`,
+	},
+	&StringTestCase{
+		`<input type="submit" name="go" value="Search" formaction="/b">`,
+		`<input type="submit" value="Search" formaction="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fb" name="mortyformaction:mortyurl=http%3A%2F%2F127.0.0.1%2Fb:go">`,
+	},
+	&StringTestCase{
+		`<input type="IMAGE" src="/i.png" formaction="/b">`,
+		`<input type="IMAGE" src="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fi.png" formaction="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fb" name="mortyformaction:mortyurl=http%3A%2F%2F127.0.0.1%2Fb:">`,
+	},
+	&StringTestCase{
+		`<input name="q" formaction="/b">`,
+		`<input name="q" formaction="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fb">`,
+	},
+	&StringTestCase{
+		`<button type="reset" name="r" formaction="/b">B</button>`,
+		`<button type="reset" name="r" formaction="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fb">B</button>`,
+	},
+	&StringTestCase{
+		`<button formaction="javascript:alert(1)">B</button>`,
+		`<button formaction="">B</button>`,
+	},
+	&StringTestCase{
+		`<button type="submit">B</button>`,
+		`<button type="submit">B</button>`,
+	},
+}
+
+func TestButtonSanitizer(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1/")
+	for _, testCase := range buttonTestData {
+		s := New(u, &ProxyRewriter{})
+		out := bytes.NewBuffer(nil)
+		s.HTML(out, strings.NewReader(testCase.Input))
+		if out.String() != testCase.ExpectedOutput {
+			t.Errorf(`Button sanitizer error. Input: "%s", Expected: "%s", Got: "%s"`, testCase.Input, testCase.ExpectedOutput, out.String())
+		}
+	}
+}
+
+var formTestData []*StringTestCase = []*StringTestCase{
+	&StringTestCase{
+		`<form action="/search?lang=en&amp;q=">`,
+		`<form action="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fsearch%3Flang%3Den%26q%3D"><input type="hidden" name="mortyurl" value="http://127.0.0.1/search" /><input type="hidden" name="lang" value="en" /><input type="hidden" name="q" value="" />`,
+	},
+	&StringTestCase{
+		`<form method="POST" action="/search?lang=en">`,
+		`<form method="POST" action="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fsearch%3Flang%3Den"><input type="hidden" name="mortyurl" value="http://127.0.0.1/search?lang=en" />`,
+	},
+	&StringTestCase{
+		`<form>`,
+		`<form><input type="hidden" name="mortyurl" value="http://127.0.0.1/" />`,
+	},
+}
+
+func TestFormSanitizer(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1/")
+	for _, testCase := range formTestData {
+		s := New(u, &ProxyRewriter{})
+		out := bytes.NewBuffer(nil)
+		s.HTML(out, strings.NewReader(testCase.Input))
+		if out.String() != testCase.ExpectedOutput {
+			t.Errorf(`Form sanitizer error. Input: "%s", Expected: "%s", Got: "%s"`, testCase.Input, testCase.ExpectedOutput, out.String())
+		}
+	}
+}
+
+type IframeTestCase struct {
+	Sandbox        string
+	BlockIframes   bool
+	Input          string
+	ExpectedOutput string
+}
+
+var iframeTestData []*IframeTestCase = []*IframeTestCase{
+	&IframeTestCase{
+		"",
+		false,
+		`<iframe src="/frame"></iframe>`,
+		`<iframe src="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fframe" sandbox=""></iframe>`,
+	},
+	&IframeTestCase{
+		IFRAME_SANDBOX_POLICIES["forms"],
+		false,
+		`<iframe sandbox="allow-scripts allow-forms allow-same-origin"></iframe>`,
+		`<iframe sandbox="allow-forms"></iframe>`,
+	},
+	&IframeTestCase{
+		IFRAME_SANDBOX_POLICIES["permissive"],
+		false,
+		`<iframe></iframe>`,
+		`<iframe sandbox="allow-forms allow-popups allow-popups-to-escape-sandbox allow-same-origin"></iframe>`,
+	},
+	&IframeTestCase{
+		"",
+		false,
+		`<iframe srcdoc="<body><a href=&quot;/a&quot; onclick=&quot;x()&quot;>a</a><script>x()</script></body>"></iframe>`,
+		`<iframe srcdoc="&lt;body&gt;&lt;a href=&#34;./?mortyurl=http%3A%2F%2F127.0.0.1%2Fa&#34;&gt;a&lt;/a&gt;&lt;/body&gt;" sandbox=""></iframe>`,
+	},
+	&IframeTestCase{
+		"",
+		true,
+		`<p>a</p><iframe src="/frame"><p>fallback</p></iframe><p>b</p>`,
+		`<p>a</p><p>b</p>`,
+	},
+}
+
+func TestIframeSanitizer(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1/")
+	for _, testCase := range iframeTestData {
+		s := New(u, &ProxyRewriter{})
+		s.IframeSandbox = testCase.Sandbox
+		s.BlockIframes = testCase.BlockIframes
+		out := bytes.NewBuffer(nil)
+		s.HTML(out, strings.NewReader(testCase.Input))
+		if out.String() != testCase.ExpectedOutput {
+			t.Errorf(`Iframe sanitizer error. Input: "%s", Expected: "%s", Got: "%s"`, testCase.Input, testCase.ExpectedOutput, out.String())
+		}
+	}
+}
+
+var attributePolicyTestData []*StringTestCase = []*StringTestCase{
+	&StringTestCase{
+		`<div role="navigation" aria-label="menu" data-id="1" onclick="x()">a</div>`,
+		`<div role="navigation" aria-label="menu" data-id="1">a</div>`,
+	},
+	&StringTestCase{
+		`<table><tr><td colspan="2" rowspan="3" itemprop="x">a</td></tr></table>`,
+		`<table><tr><td colspan="2" rowspan="3" itemprop="x">a</td></tr></table>`,
+	},
+	&StringTestCase{
+		`<ol start="3" reversed><li><time datetime="2020-01-01">a</time></li></ol>`,
+		`<ol start="3" reversed=""><li><time datetime="2020-01-01">a</time></li></ol>`,
+	},
+	&StringTestCase{
+		`<p colspan="2">a</p>`,
+		`<p>a</p>`,
+	},
+}
+
+func TestAttributePolicy(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1/")
+	for _, testCase := range attributePolicyTestData {
+		s := New(u, &ProxyRewriter{})
+		out := bytes.NewBuffer(nil)
+		s.HTML(out, strings.NewReader(testCase.Input))
+		if out.String() != testCase.ExpectedOutput {
+			t.Errorf(`Attribute policy error. Input: "%s", Expected: "%s", Got: "%s"`, testCase.Input, testCase.ExpectedOutput, out.String())
+		}
+	}
+}
+
+var xhtmlTestData []*StringTestCase = []*StringTestCase{
+	&StringTestCase{
+		`<?xml version="1.0" encoding="ISO-8859-1"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="fr"><head><link rel="stylesheet" href="s.css"/><script>x()</script></head>` +
+			"<body onload=\"x()\"><p>Caf\xe9&nbsp;<a href=\"/b?c=1&amp;d=2\">b</a><br/><![CDATA[<script>]]></p><noscript><p>n</p></noscript></body></html>",
+		`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="fr"><head><link rel="stylesheet" href="./?mortyurl=http%3A%2F%2F127.0.0.1%2Fs.css" /></head>` +
+			"<body><p>Café\u00a0<a href=\"./?mortyurl=http%3A%2F%2F127.0.0.1%2Fb%3Fc%3D1%26d%3D2\">b</a><br></br>&lt;script&gt;</p><p>n</p></body></html>",
+	},
+	&StringTestCase{
+		`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:svg="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">` +
+			`<body><svg:svg><svg:script>x()</svg:script></svg:svg><x:p xmlns:x="http://www.w3.org/1999/xhtml" xlink:href="javascript:x()">p</x:p>` +
+			`<style>a > b { background: url(bg.png) }</style></body></html>`,
+		`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+			`<html xmlns="http://www.w3.org/1999/xhtml"><body><p>p</p><style>a &gt; b { background: url(./?mortyurl=http%3A%2F%2F127.0.0.1%2Fbg.png) }</style></body></html>`,
+	},
+	&StringTestCase{
+		`<?xml-stylesheet type="text/xsl" href="t.xsl"?><html xmlns="http://www.w3.org/1999/xhtml"></html>`,
+		``,
+	},
+	&StringTestCase{
+		`<!DOCTYPE html [<!ENTITY x "expanded">]><html xmlns="http://www.w3.org/1999/xhtml">&x;</html>`,
+		``,
+	},
+	&StringTestCase{
+		`<html xmlns="http://www.w3.org/1999/xhtml"><body><p>unclosed</body></html>`,
+		``,
+	},
+	&StringTestCase{
+		`<svg xmlns="http://www.w3.org/2000/svg"><script>x()</script></svg>`,
+		``,
+	},
+}
+
+func TestXHTMLSanitizer(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1/")
+	for _, testCase := range xhtmlTestData {
+		s := New(u, &ProxyRewriter{})
+		out := bytes.NewBuffer(nil)
+		err := s.XHTML(out, strings.NewReader(testCase.Input))
+		if out.String() != testCase.ExpectedOutput || (err == nil) != (testCase.ExpectedOutput != "") {
+			t.Errorf(`XHTML sanitizer error. Input: "%s", Expected: "%s", Got: "%s" %v`, testCase.Input, testCase.ExpectedOutput, out.String(), err)
+		}
+	}
+}
+
+func TestXHTMLExtensions(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1/")
+	s := New(u, &ProxyRewriter{})
+	s.HeadExtension = func(w io.Writer) {
+		io.WriteString(w, `<meta name="referrer" content="no-referrer">`)
+	}
+	s.BodyExtension = func(w io.Writer) {
+		io.WriteString(w, `<div id="header"><input type="url" readonly><br>a &amp; b</div>`)
+	}
+	for input, expected := range map[string]string{
+		`<html xmlns="http://www.w3.org/1999/xhtml"><head></head><body><p>a</p></body></html>`: `<html xmlns="http://www.w3.org/1999/xhtml"><head><meta name="referrer" content="no-referrer" /></head><body><p>a</p><div id="header"><input type="url" readonly="" /><br />a &amp; b</div></body></html>`,
+		`<html xmlns="http://www.w3.org/1999/xhtml"><p>a</p></html>`:                           `<html xmlns="http://www.w3.org/1999/xhtml"><p>a</p><div id="header"><input type="url" readonly="" /><br />a &amp; b</div></html>`,
+	} {
+		out := bytes.NewBuffer(nil)
+		s.XHTML(out, strings.NewReader(input))
+		if !strings.HasSuffix(out.String(), expected) {
+			t.Errorf(`XHTML extension error. Input: "%s", Expected: "%s", Got: "%s"`, input, expected, out.String())
+		}
+	}
+}
+
+func TestSanitizeURI(t *testing.T) {
+	for _, testCase := range sanitizeUriTestData {
+		newUrl, scheme := sanitizeURI(testCase.Input)
+		if !bytes.Equal(newUrl, testCase.ExpectedOutput) {
+			t.Errorf(
+				`URL proxifier error. Expected: "%s", Got: "%s"`,
+				testCase.ExpectedOutput,
+				newUrl,
+			)
+		}
+		if scheme != testCase.ExpectedScheme {
+			t.Errorf(
+				`URL proxifier error. Expected: "%s", Got: "%s"`,
+				testCase.ExpectedScheme,
+				scheme,
+			)
+		}
+	}
+}
+
+func TestURLProxifier(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1/")
+	s := New(u, &ProxyRewriter{})
+	for _, testCase := range urlTestData {
+		newUrl, err := s.URL(testCase.Input)
+		if err != nil {
+			t.Errorf("Failed to parse URL: %s", testCase.Input)
+		}
+		if newUrl != testCase.ExpectedOutput {
+			t.Errorf(
+				`URL proxifier error. Expected: "%s", Got: "%s"`,
+				testCase.ExpectedOutput,
+				newUrl,
+			)
+		}
+	}
+}
+
+var pathRewriterTestData []*StringTestCase = []*StringTestCase{
+	&StringTestCase{
+		"http://x.com",
+		"https://proxy.example.org/http/x.com/",
+	},
+	&StringTestCase{
+		"https://x.com:8080/a%20b/c?d=e",
+		"https://proxy.example.org/https/x.com:8080/a%20b/c?d=e",
+	},
+}
+
+func TestPathRewriter(t *testing.T) {
+	r := &PathRewriter{Prefix: "https://proxy.example.org/"}
+	for _, testCase := range pathRewriterTestData {
+		u, _ := url.Parse(testCase.Input)
+		rewritten, err := r.RewriteURL(u)
+		if err != nil || rewritten != testCase.ExpectedOutput {
+			t.Errorf(`Path rewriter error. Expected: "%s", Got: "%s" %v`, testCase.ExpectedOutput, rewritten, err)
+		}
+	}
+
+	r.Key = []byte("key")
+	u, _ := url.Parse("https://x.com/a%20b?c=d")
+	rewritten, _ := r.RewriteURL(u)
+	rewrittenURL, _ := url.Parse(rewritten)
+	path := strings.TrimPrefix(rewrittenURL.EscapedPath(), "/")
+	target, err := r.TargetURL(path, rewrittenURL.RawQuery)
+	if err != nil || target.String() != u.String() {
+		t.Errorf(`Path rewriter error. Expected: "%s", Got: "%s" %v`, u, target, err)
+	}
+	if _, err := r.TargetURL("00"+path[2:], ""); err == nil {
+		t.Errorf("Path rewriter error: the signature is not checked")
+	}
+	if _, err := r.TargetURL("javascript/x", ""); err == nil {
+		t.Errorf("Path rewriter error: invalid target accepted")
+	}
+}
+
+var sameOriginTestData []*StringTestCase = []*StringTestCase{
+	&StringTestCase{
+		`<a href="/a">a</a><img src="http://cdn.x.com/b.png" />`,
+		`<a href="http://127.0.0.1/a">a</a><img src="./?mortyurl=http%3A%2F%2Fcdn.x.com%2Fb.png" />`,
+	},
+	&StringTestCase{
+		`<form action="/search">`,
+		`<form action="http://127.0.0.1/search">`,
+	},
+	&StringTestCase{
+		`<form action="http://x.com/search">`,
+		`<form action="./?mortyurl=http%3A%2F%2Fx.com%2Fsearch"><input type="hidden" name="mortyurl" value="http://x.com/search" />`,
+	},
+}
+
+func TestSameOriginRewriter(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1/")
+	for _, testCase := range sameOriginTestData {
+		s := New(u, &SameOriginRewriter{Origin: u, Next: &ProxyRewriter{}})
+		out := bytes.NewBuffer(nil)
+		s.HTML(out, strings.NewReader(testCase.Input))
+		if out.String() != testCase.ExpectedOutput {
+			t.Errorf(`Same origin rewriter error. Input: "%s", Expected: "%s", Got: "%s"`, testCase.Input, testCase.ExpectedOutput, out.String())
+		}
+	}
+}
+
+func TestURLRewriterFunc(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1/")
+	s := New(u, URLRewriterFunc(func(u *url.URL) (string, error) {
+		return "https://cdn.example.org/" + u.Host + u.Path, nil
+	}))
+	out := bytes.NewBuffer(nil)
+	s.CSS(out, strings.NewReader(`a { background: url("/b.png") }`))
+	expected := `a { background: url("https://cdn.example.org/127.0.0.1/b.png") }`
+	if out.String() != expected {
+		t.Errorf(`URL rewriter error. Expected: "%s", Got: "%s"`, expected, out.String())
+	}
+}
+
+var BENCH_SIMPLE_HTML []byte = []byte(`<!doctype html>
+<html>
+ <head>
+  <title>test</title>
+ </head>
+ <body>
+  <h1>Test heading</h1>
+ </body>
+</html>`)
+
+func BenchmarkSanitizeSimpleHTML(b *testing.B) {
+	u, _ := url.Parse("http://127.0.0.1/")
+	s := New(u, &ProxyRewriter{})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out := bytes.NewBuffer(nil)
+		s.HTML(out, bytes.NewReader(BENCH_SIMPLE_HTML))
+	}
+}
+
+var BENCH_COMPLEX_HTML []byte = []byte(`<!doctype html>
+<html>
+ <head>
+  <noscript><meta http-equiv="refresh" content="0; URL=./xy"></noscript>
+  <title>test 2</title>
+  <script> alert('xy'); </script>
+  <link rel="stylesheet" href="./core.bundle.css">
+  <style>
+   html { background: url(./a.jpg); }
+  </style
+ </head>
+ <body>
+  <h1>Test heading</h1>
+  <img src="b.png" alt="imgtitle" />
+  <form action="/z">
+  <input type="submit" style="background: url(http://aa.bb/cc)" >
+  </form>
+ </body>
+</html>`)
+
+func BenchmarkSanitizeComplexHTML(b *testing.B) {
+	u, _ := url.Parse("http://127.0.0.1/")
+	s := New(u, &ProxyRewriter{})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out := bytes.NewBuffer(nil)
+		s.HTML(out, bytes.NewReader(BENCH_COMPLEX_HTML))
+	}
+}
@@ -0,0 +1,250 @@
+package sanitizer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// XHTML_NAMESPACE is the namespace of the XHTML elements. The elements of the other namespaces,
+// like SVG and MathML, are removed with their content.
+const XHTML_NAMESPACE = "http://www.w3.org/1999/xhtml"
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// ErrXSLT is returned for the XHTML documents with an XSLT stylesheet: the browser would transform
+// the sanitized document.
+var ErrXSLT = errors.New("XSLT processing instruction")
+
+// ErrDTDSubset is returned for the XHTML documents whose DTD has an internal subset, which may
+// declare entities.
+var ErrDTDSubset = errors.New("DTD internal subset")
+
+// XHTML reads an XHTML document from r and writes the sanitized document to w, as well-formed
+// UTF-8 XML. The encoding declaration of the document is honored. The elements are sanitized like
+// the HTML elements. Nothing is written if the document is not well-formed.
+func (s *Sanitizer) XHTML(w io.Writer, r io.Reader) error {
+	// the document state, like the base URL, is not kept between documents
+	d := *s
+	out := bytes.NewBuffer(nil)
+	if err := d.sanitizeXHTML(out, r); err != nil {
+		return err
+	}
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func (s *Sanitizer) sanitizeXHTML(out *bytes.Buffer, r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	// the HTML entities are known, the DTDs are never read
+	decoder.Entity = xml.HTMLEntity
+
+	out.WriteString(xml.Header)
+	// the open elements: false if only the content of the element is written
+	var openElements []bool
+	// the depth in a removed element
+	removed := 0
+	rootWritten := false
+	inStyle := false
+	bodyExtensionWritten := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			if !rootWritten {
+				return errors.New("no XHTML root element")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if removed > 0 {
+			switch token.(type) {
+			case xml.StartElement:
+				removed++
+			case xml.EndElement:
+				removed--
+			}
+			continue
+		}
+
+		switch t := token.(type) {
+		case xml.ProcInst:
+			if t.Target == "xml-stylesheet" {
+				return ErrXSLT
+			}
+
+		case xml.Directive:
+			if bytes.ContainsRune(t, '[') {
+				return ErrDTDSubset
+			}
+			if bytes.HasPrefix(bytes.ToUpper(t), []byte("DOCTYPE")) && !rootWritten {
+				out.WriteString("<!DOCTYPE html>\n")
+			}
+
+		case xml.StartElement:
+			tag := []byte(t.Name.Local)
+			if rootWritten && len(openElements) == 0 {
+				return errors.New("XML syntax error: multiple root elements")
+			}
+			if (t.Name.Space != XHTML_NAMESPACE && t.Name.Space != "") || s.unsafeElement(tag) {
+				removed = 1
+				break
+			}
+			attrs, lang := xhtmlAttrs(t.Attr)
+			switch t.Name.Local {
+			case "base":
+				for _, attr := range attrs {
+					if bytes.Equal(attr[0], []byte("href")) {
+						if parsedURI, err := url.Parse(string(attr[1])); err == nil {
+							s.BaseURL = parsedURI
+						}
+					}
+				}
+				removed = 1
+				continue
+			case "link":
+				s.sanitizeLinkTag(out, attrs, " />")
+				removed = 1
+				continue
+			case "meta":
+				s.sanitizeMetaTag(out, attrs, " />")
+				removed = 1
+				continue
+			case "noscript":
+				// skip noscript tags - only the tag, not the content, because javascript is sanitized
+				if len(openElements) > 0 {
+					openElements = append(openElements, false)
+					continue
+				}
+			}
+
+			fmt.Fprintf(out, "<%s", tag)
+			if !rootWritten {
+				fmt.Fprintf(out, ` xmlns="%s"`, XHTML_NAMESPACE)
+				rootWritten = true
+			}
+			if lang != "" {
+				fmt.Fprintf(out, ` xml:lang="%s"`, html.EscapeString(lang))
+			}
+			switch t.Name.Local {
+			case "iframe":
+				// the sandbox attribute is always written
+				s.sanitizeIframeAttrs(out, attrs)
+			case "button", "input":
+				s.sanitizeSubmitterAttrs(out, tag, attrs)
+			default:
+				s.sanitizeAttrs(out, tag, attrs)
+			}
+			out.WriteString(">")
+			openElements = append(openElements, true)
+
+			switch t.Name.Local {
+			case "head":
+				if s.HeadExtension != nil {
+					writeXHTMLExtension(out, s.HeadExtension, atom.Head)
+				}
+			case "form":
+				s.writeFormInputs(out, attrs)
+			case "style":
+				inStyle = true
+			}
+
+		case xml.EndElement:
+			open := openElements[len(openElements)-1]
+			openElements = openElements[:len(openElements)-1]
+			if !open {
+				break
+			}
+			if t.Name.Local == "style" {
+				inStyle = false
+			}
+			// the body extension is written at the end of the root element of a document without body
+			if (t.Name.Local == "body" || len(openElements) == 0) && !bodyExtensionWritten && s.BodyExtension != nil {
+				writeXHTMLExtension(out, s.BodyExtension, atom.Body)
+				bodyExtensionWritten = true
+			}
+			fmt.Fprintf(out, "</%s>", t.Name.Local)
+
+		case xml.CharData:
+			if len(openElements) == 0 {
+				break
+			}
+			if inStyle {
+				css := bytes.NewBuffer(nil)
+				s.sanitizeCSS(css, t)
+				t = css.Bytes()
+			}
+			out.WriteString(html.EscapeString(string(t)))
+
+		case xml.Comment:
+			// ignore comment
+		}
+	}
+}
+
+// xhtmlAttrs returns the attributes without namespace, like the HTML attributes, and the xml:lang
+// attribute. The namespace declarations and the other attributes are removed.
+func xhtmlAttrs(xmlAttrs []xml.Attr) ([][][]byte, string) {
+	var attrs [][][]byte
+	var lang string
+	for _, attr := range xmlAttrs {
+		switch {
+		case attr.Name.Space == "" && attr.Name.Local != "xmlns":
+			attrs = append(attrs, [][]byte{
+				[]byte(attr.Name.Local),
+				[]byte(attr.Value),
+				[]byte(html.EscapeString(attr.Value)),
+			})
+		case attr.Name.Space == xmlNamespace && attr.Name.Local == "lang":
+			lang = attr.Value
+		}
+	}
+	return attrs, lang
+}
+
+// writeXHTMLExtension writes the HTML of the extension as XHTML. The HTML is parsed in the context
+// element.
+func writeXHTMLExtension(out *bytes.Buffer, extension func(w io.Writer), context atom.Atom) {
+	buf := bytes.NewBuffer(nil)
+	extension(buf)
+	nodes, err := html.ParseFragment(buf, &html.Node{Type: html.ElementNode, Data: context.String(), DataAtom: context})
+	if err != nil {
+		return
+	}
+	for _, n := range nodes {
+		writeXHTMLNode(out, n)
+	}
+}
+
+func writeXHTMLNode(out *bytes.Buffer, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		out.WriteString(html.EscapeString(n.Data))
+	case html.ElementNode:
+		fmt.Fprintf(out, "<%s", n.Data)
+		for _, attr := range n.Attr {
+			if attr.Namespace == "" {
+				fmt.Fprintf(out, ` %s="%s"`, attr.Key, html.EscapeString(attr.Val))
+			}
+		}
+		if n.FirstChild == nil {
+			out.WriteString(" />")
+			return
+		}
+		out.WriteString(">")
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeXHTMLNode(out, c)
+		}
+		fmt.Fprintf(out, "</%s>", n.Data)
+	}
+}
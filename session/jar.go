@@ -0,0 +1,137 @@
+package session
+
+import (
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// cookieEntry is the size and the expiry of a cookie stored in the jar.
+type cookieEntry struct {
+	size    int
+	expires time.Time // zero for a session cookie
+}
+
+// Jar stores the upstream cookies of a session in a net/http/cookiejar jar, which follows the RFC
+// 6265 matching rules. The cookies can't be set for a public suffix, like co.uk or github.io. The
+// total size of the cookies is capped: cookies beyond the limit are dropped.
+type Jar struct {
+	maxSize int
+	size    int
+	jar     *cookiejar.Jar
+	// the stored cookies by domain, path and name: the cookiejar jar doesn't expose them
+	cookies map[string]cookieEntry
+}
+
+func newJar(maxSize int) *Jar {
+	// cookiejar.New never fails
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &Jar{maxSize: maxSize, jar: jar, cookies: make(map[string]cookieEntry)}
+}
+
+// SetCookies stores the cookies of the Set-Cookie header values received from u.
+func (j *Jar) SetCookies(u *url.URL, setCookies []string) {
+	now := time.Now()
+	j.purge(now)
+	response := &http.Response{Header: http.Header{"Set-Cookie": setCookies}}
+	var accepted []*http.Cookie
+	for _, c := range response.Cookies() {
+		domain, ok := cookieDomain(canonicalHost(u), c.Domain)
+		if !ok {
+			// rejected by the cookiejar jar too
+			continue
+		}
+		path := c.Path
+		if !strings.HasPrefix(path, "/") {
+			path = defaultPath(u.Path)
+		}
+		id := domain + ";" + path + ";" + c.Name
+		entry := cookieEntry{size: len(c.Name) + len(c.Value) + len(domain) + len(path)}
+		switch {
+		case c.MaxAge < 0:
+			entry.expires = now.Add(-time.Second)
+		case c.MaxAge > 0:
+			entry.expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			entry.expires = c.Expires
+		}
+
+		old := j.cookies[id]
+		if !entry.expires.IsZero() && !entry.expires.After(now) {
+			// expired cookie: it only removes the previous one
+			j.size -= old.size
+			delete(j.cookies, id)
+		} else if j.size-old.size+entry.size > j.maxSize {
+			continue
+		} else {
+			j.size += entry.size - old.size
+			j.cookies[id] = entry
+		}
+		accepted = append(accepted, c)
+	}
+	j.jar.SetCookies(u, accepted)
+}
+
+// Cookies returns the name and value pairs of the cookies to send to u, ordered as RFC 6265
+// recommends: longest paths first, then oldest first.
+func (j *Jar) Cookies(u *url.URL) [][2]string {
+	j.purge(time.Now())
+	cookies := j.jar.Cookies(u)
+	pairs := make([][2]string, len(cookies))
+	for i, c := range cookies {
+		pairs[i] = [2]string{c.Name, c.Value}
+	}
+	return pairs
+}
+
+// purge removes the expired cookies from the size of the jar. The cookiejar jar ignores them.
+func (j *Jar) purge(now time.Time) {
+	for id, entry := range j.cookies {
+		if !entry.expires.IsZero() && !entry.expires.After(now) {
+			j.size -= entry.size
+			delete(j.cookies, id)
+		}
+	}
+}
+
+func canonicalHost(u *url.URL) string {
+	return strings.ToLower(u.Hostname())
+}
+
+// cookieDomain returns the domain of a cookie set by host with the Domain attribute domain, as the
+// cookiejar jar computes it. A cookie can be set for host and its parent domains, except the
+// public suffixes.
+func cookieDomain(host, domain string) (string, bool) {
+	if domain == "" {
+		return host, true
+	}
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	if domain == "" || strings.HasSuffix(domain, ".") {
+		return "", false
+	}
+	if net.ParseIP(host) != nil {
+		return host, domain == host
+	}
+	if domain == publicsuffix.List.PublicSuffix(domain) {
+		// a host-only cookie of a public suffix host
+		return host, domain == host
+	}
+	return domain, domain == host || strings.HasSuffix(host, "."+domain)
+}
+
+// defaultPath is the directory of the request path (RFC 6265 section 5.1.4).
+func defaultPath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
@@ -0,0 +1,174 @@
+package session
+
+import (
+	"container/list"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// COOKIE_NAME is the name of the cookie morty issues to identify a session.
+const COOKIE_NAME = "mortysession"
+
+// ErrStoreFull is returned when a session can't be created: the existing sessions are not dropped,
+// so a client can't log the others out by creating sessions.
+var ErrStoreFull = errors.New("too many sessions")
+
+// Session holds the upstream cookies of a client. They stay on the server: the client only gets
+// an encrypted session identifier.
+type Session struct {
+	id      string
+	mu      sync.Mutex
+	jar     *Jar
+	expires time.Time
+	element *list.Element
+}
+
+func (s *Session) SetCookies(u *url.URL, setCookies []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jar.SetCookies(u, setCookies)
+}
+
+func (s *Session) Cookies(u *url.URL) [][2]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jar.Cookies(u)
+}
+
+// Store keeps the sessions in memory. A session expires when it is not used during the TTL; when
+// there are too many sessions, no session is created until one expires.
+type Store struct {
+	aead        cipher.AEAD
+	ttl         time.Duration
+	maxSessions int
+	maxJarSize  int
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+	lru      *list.List // front is the most recently used session, so the last to expire
+	now      func() time.Time
+}
+
+// NewStore returns an empty Store. The session identifiers are encrypted with a random key, so
+// the cookies issued before a restart are ignored, like the sessions they referred to.
+func NewStore(ttl time.Duration, maxSessions, maxJarSize int) (*Store, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		aead:        aead,
+		ttl:         ttl,
+		maxSessions: maxSessions,
+		maxJarSize:  maxJarSize,
+		sessions:    make(map[string]*Session),
+		lru:         list.New(),
+		now:         time.Now,
+	}, nil
+}
+
+// TTL returns the lifetime of an unused session.
+func (st *Store) TTL() time.Duration {
+	return st.ttl
+}
+
+// New creates a session and returns it with the value of the cookie identifying it. It returns
+// ErrStoreFull if there are too many sessions.
+func (st *Store) New() (*Session, string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	nonce := make([]byte, st.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+	cookieValue := base64.RawURLEncoding.EncodeToString(st.aead.Seal(nonce, nonce, id, nil))
+
+	s := &Session{id: hex.EncodeToString(id), jar: newJar(st.maxJarSize)}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := st.now()
+	st.purge(now)
+	if len(st.sessions) >= st.maxSessions {
+		return nil, "", ErrStoreFull
+	}
+	s.expires = now.Add(st.ttl)
+	st.sessions[s.id] = s
+	s.element = st.lru.PushFront(s)
+	return s, cookieValue, nil
+}
+
+// Get returns the session identified by a cookie value, or nil if the value is invalid or the
+// session has expired. The session lifetime is extended.
+func (st *Store) Get(cookieValue string) *Session {
+	if cookieValue == "" {
+		return nil
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(cookieValue)
+	if err != nil || len(sealed) < st.aead.NonceSize() {
+		return nil
+	}
+	nonceSize := st.aead.NonceSize()
+	id, err := st.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := st.now()
+	st.purge(now)
+	s, found := st.sessions[hex.EncodeToString(id)]
+	if !found {
+		return nil
+	}
+	if !s.expires.After(now) {
+		st.remove(s)
+		return nil
+	}
+	s.expires = now.Add(st.ttl)
+	st.lru.MoveToFront(s.element)
+	return s
+}
+
+// Delete removes a session and its cookies.
+func (st *Store) Delete(s *Session) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.sessions[s.id] == s {
+		st.remove(s)
+	}
+}
+
+// purge removes the expired sessions. They are the least recently used ones.
+func (st *Store) purge(now time.Time) {
+	for st.lru.Len() > 0 {
+		s := st.lru.Back().Value.(*Session)
+		if s.expires.After(now) {
+			return
+		}
+		st.remove(s)
+	}
+}
+
+func (st *Store) remove(s *Session) {
+	delete(st.sessions, s.id)
+	st.lru.Remove(s.element)
+}
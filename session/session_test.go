@@ -0,0 +1,154 @@
+package session
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type JarTestCase struct {
+	URL             string
+	ExpectedCookies [][2]string
+}
+
+var jarSetCookies []string = []string{
+	"a=1",
+	"b=2; Path=/docs",
+	"c=3; Domain=.example.com",
+	"d=4; Secure",
+	"e=5; Domain=other.com",
+	"f=6; Max-Age=3600",
+	"g=7; Expires=Thu, 01 Jan 1970 00:00:00 GMT",
+}
+
+var jarTestData []*JarTestCase = []*JarTestCase{
+	&JarTestCase{"http://www.example.com/", [][2]string{{"a", "1"}, {"c", "3"}, {"f", "6"}}},
+	&JarTestCase{"https://www.example.com/docs/x", [][2]string{{"b", "2"}, {"a", "1"}, {"c", "3"}, {"d", "4"}, {"f", "6"}}},
+	&JarTestCase{"http://www.example.com/docsx", [][2]string{{"a", "1"}, {"c", "3"}, {"f", "6"}}},
+	&JarTestCase{"http://sub.example.com/", [][2]string{{"c", "3"}}},
+	&JarTestCase{"http://a.www.example.com/", [][2]string{{"c", "3"}}},
+	&JarTestCase{"http://other.com/", nil},
+}
+
+func TestJar(t *testing.T) {
+	jar := newJar(4096)
+	u, _ := url.Parse("https://www.example.com/")
+	for _, setCookie := range jarSetCookies {
+		jar.SetCookies(u, []string{setCookie})
+		// keep a stable creation order
+		time.Sleep(time.Millisecond)
+	}
+	for _, testCase := range jarTestData {
+		u, _ := url.Parse(testCase.URL)
+		cookies := jar.Cookies(u)
+		if len(cookies) == 0 && len(testCase.ExpectedCookies) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(cookies, testCase.ExpectedCookies) {
+			t.Errorf(`Cookie jar error. URL: "%s", Expected: %v, Got: %v`, testCase.URL, testCase.ExpectedCookies, cookies)
+		}
+	}
+
+	// deletion
+	jar.SetCookies(u, []string{"a=1; Max-Age=-1"})
+	if cookies := jar.Cookies(u); len(cookies) != 3 {
+		t.Errorf("Cookie a is not deleted: %v", cookies)
+	}
+}
+
+func TestJarPublicSuffix(t *testing.T) {
+	jar := newJar(4096)
+	for _, testCase := range []struct {
+		From      string
+		SetCookie string
+		To        string
+		Sent      bool
+	}{
+		{"https://www.example.co.uk/", "a=1; Domain=co.uk", "https://other.co.uk/", false},
+		{"https://www.example.co.uk/", "b=2; Domain=.co.uk", "https://www.example.co.uk/", false},
+		{"https://a.github.io/", "c=3; Domain=github.io", "https://b.github.io/", false},
+		{"https://a.github.io/", "d=4; Domain=a.github.io", "https://x.a.github.io/", true},
+		// a public suffix host can only set host-only cookies
+		{"https://github.io/", "e=5; Domain=github.io", "https://github.io/", true},
+		{"https://github.io/", "f=6; Domain=github.io", "https://a.github.io/", false},
+	} {
+		from, _ := url.Parse(testCase.From)
+		to, _ := url.Parse(testCase.To)
+		jar.SetCookies(from, []string{testCase.SetCookie})
+		name := strings.SplitN(testCase.SetCookie, "=", 2)[0]
+		sent := false
+		for _, cookie := range jar.Cookies(to) {
+			sent = sent || cookie[0] == name
+		}
+		if sent != testCase.Sent {
+			t.Errorf("Public suffix error for \"%s\" from %s to %s. Expected: %t, Got: %t", testCase.SetCookie, testCase.From, testCase.To, testCase.Sent, sent)
+		}
+	}
+}
+
+func TestJarMaxSize(t *testing.T) {
+	jar := newJar(10)
+	u, _ := url.Parse("http://a.b/")
+	jar.SetCookies(u, []string{"a=1", "toolarge=1"})
+	if cookies := jar.Cookies(u); len(cookies) != 1 || jar.size != 6 {
+		t.Errorf("The jar size cap is not enforced: %v", cookies)
+	}
+}
+
+func TestStore(t *testing.T) {
+	now := time.Now()
+	st, err := NewStore(time.Hour, 2, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.now = func() time.Time { return now }
+
+	s1, value1, _ := st.New()
+	if st.Get(value1) != s1 {
+		t.Errorf("Session not found from its cookie")
+	}
+	for _, invalid := range []string{"", "x", value1[:len(value1)-2] + "AA", value1 + "A"} {
+		if st.Get(invalid) != nil {
+			t.Errorf("A tampered cookie must be rejected: %s", invalid)
+		}
+	}
+
+	// TTL
+	now = now.Add(30 * time.Minute)
+	_, value2, _ := st.New()
+	now = now.Add(45 * time.Minute)
+	if st.Get(value1) != nil {
+		t.Errorf("Session 1 must be expired")
+	}
+	if st.Get(value2) == nil {
+		t.Errorf("Session 2 must still be valid")
+	}
+
+	// maximum number of sessions: the existing ones are kept
+	now = now.Add(time.Minute)
+	_, value3, _ := st.New()
+	if _, _, err := st.New(); err != ErrStoreFull {
+		t.Errorf("Expected ErrStoreFull, got %v", err)
+	}
+	if st.Get(value2) == nil || st.Get(value3) == nil {
+		t.Errorf("A session must not be dropped for a new one")
+	}
+
+	s3 := st.Get(value3)
+	st.Delete(s3)
+	if st.Get(value3) != nil {
+		t.Errorf("Deleted session still found")
+	}
+	_, value4, err := st.New()
+	if err != nil || st.Get(value4) == nil {
+		t.Errorf("A session must be created once another is deleted: %v", err)
+	}
+
+	// the expired sessions make room for the new ones
+	now = now.Add(2 * time.Hour)
+	if _, _, err := st.New(); err != nil || len(st.sessions) != 1 || st.lru.Len() != 1 {
+		t.Errorf("The expired sessions must be removed: %v, %d sessions", err, len(st.sessions))
+	}
+}
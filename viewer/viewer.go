@@ -0,0 +1,147 @@
+// Package viewer renders plain text, JSON and XML documents as HTML fragments: the text with line
+// numbers, the JSON pretty-printed with collapsible objects and arrays, and the XML as a tree of
+// collapsible elements. The fragments use the classes of STYLE and need no script.
+package viewer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+)
+
+// MAX_JSON_DEPTH is the maximum nesting depth of the rendered JSON documents.
+const MAX_JSON_DEPTH = 256
+
+// MAX_XML_DEPTH is the maximum nesting depth of the rendered XML documents.
+const MAX_XML_DEPTH = 256
+
+// STYLE is the CSS of the fragments.
+var STYLE string = `
+.mortyviewer-lines { font-family: monospace; font-size: 0.9em; margin: 0; padding-left: 5em; color: #888; }
+.mortyviewer-lines li { white-space: pre-wrap; word-break: break-all; min-height: 1.2em; }
+.mortyviewer-lines code { color: #222; }
+.mortyviewer-json { font-family: monospace; font-size: 0.9em; color: #222; }
+.mortyviewer-json ul { list-style: none; margin: 0; padding-left: 1.5em; border-left: 1px dotted #CCC; }
+.mortyviewer-json summary { cursor: pointer; color: #888; }
+.mortyviewer-key { color: #7B3F99; }
+.mortyviewer-string { color: #1A7F37; word-break: break-all; }
+.mortyviewer-number { color: #0550AE; }
+.mortyviewer-literal { color: #CF222E; }
+.mortyviewer-xml { font-family: monospace; font-size: 0.9em; color: #222; }
+.mortyviewer-xml ul { list-style: none; margin: 0; padding-left: 1.5em; border-left: 1px dotted #CCC; }
+.mortyviewer-xml summary { cursor: pointer; }
+.mortyviewer-tag { color: #116329; }
+.mortyviewer-comment { color: #888; white-space: pre-wrap; }
+`
+
+// Text writes the lines of text as an ordered list.
+func Text(w io.Writer, text []byte) error {
+	text = bytes.TrimSuffix(text, []byte("\n"))
+	if _, err := io.WriteString(w, `<ol class="mortyviewer-lines">`); err != nil {
+		return err
+	}
+	for _, line := range bytes.Split(text, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if _, err := fmt.Fprintf(w, "<li><code>%s</code></li>", html.EscapeString(string(line))); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</ol>")
+	return err
+}
+
+// JSON writes a JSON document pretty-printed. The key order of the objects is kept. Nothing is
+// written if the document is invalid.
+func JSON(w io.Writer, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	out := bytes.NewBuffer(nil)
+	out.WriteString(`<div class="mortyviewer-json">`)
+	if err := renderValue(out, dec, 0); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid JSON: data after the top-level value")
+	}
+	out.WriteString("</div>")
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func renderValue(out *bytes.Buffer, dec *json.Decoder, depth int) error {
+	if depth > MAX_JSON_DEPTH {
+		return errors.New("JSON document too deep")
+	}
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch v := token.(type) {
+	case json.Delim:
+		return renderContainer(out, dec, v, depth)
+	case string:
+		out.WriteString(`<span class="mortyviewer-string">`)
+		out.WriteString(html.EscapeString(quote(v)))
+		out.WriteString(`</span>`)
+	case json.Number:
+		fmt.Fprintf(out, `<span class="mortyviewer-number">%s</span>`, html.EscapeString(v.String()))
+	case bool:
+		fmt.Fprintf(out, `<span class="mortyviewer-literal">%t</span>`, v)
+	case nil:
+		out.WriteString(`<span class="mortyviewer-literal">null</span>`)
+	}
+	return nil
+}
+
+// renderContainer writes an object or an array as a <details> element, open by default.
+func renderContainer(out *bytes.Buffer, dec *json.Decoder, delim json.Delim, depth int) error {
+	open, end := "{", "}"
+	if delim == '[' {
+		open, end = "[", "]"
+	}
+	items := bytes.NewBuffer(nil)
+	count := 0
+	for dec.More() {
+		items.WriteString("<li>")
+		if delim == '{' {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(items, `<span class="mortyviewer-key">%s</span>: `, html.EscapeString(quote(key.(string))))
+		}
+		if err := renderValue(items, dec, depth+1); err != nil {
+			return err
+		}
+		items.WriteString("</li>")
+		count++
+	}
+	// the closing delimiter
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if count == 0 {
+		fmt.Fprintf(out, "<span>%s%s</span>", open, end)
+		return nil
+	}
+	unit := "items"
+	if delim == '{' {
+		unit = "keys"
+	}
+	fmt.Fprintf(out, "<details open><summary>%s %d %s</summary><ul>", open, count, unit)
+	items.WriteTo(out)
+	fmt.Fprintf(out, "</ul>%s</details>", end)
+	return nil
+}
+
+// quote returns the JSON string of s, without escaping the HTML characters.
+func quote(s string) string {
+	b := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return string(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+}
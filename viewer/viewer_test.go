@@ -0,0 +1,125 @@
+package viewer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type StringTestCase struct {
+	Input          string
+	ExpectedOutput string
+}
+
+var textTestData []*StringTestCase = []*StringTestCase{
+	&StringTestCase{
+		"User-Agent: *\r\nDisallow: /admin\n",
+		`<ol class="mortyviewer-lines"><li><code>User-Agent: *</code></li><li><code>Disallow: /admin</code></li></ol>`,
+	},
+	&StringTestCase{
+		"<script>\n\nalert(1)</script>",
+		`<ol class="mortyviewer-lines"><li><code>&lt;script&gt;</code></li><li><code></code></li><li><code>alert(1)&lt;/script&gt;</code></li></ol>`,
+	},
+}
+
+var jsonTestData []*StringTestCase = []*StringTestCase{
+	&StringTestCase{
+		`{"b": 1, "a": [true, null, "<i>"], "c": {}}`,
+		`<div class="mortyviewer-json"><details open><summary>{ 3 keys</summary><ul>` +
+			`<li><span class="mortyviewer-key">&#34;b&#34;</span>: <span class="mortyviewer-number">1</span></li>` +
+			`<li><span class="mortyviewer-key">&#34;a&#34;</span>: <details open><summary>[ 3 items</summary><ul>` +
+			`<li><span class="mortyviewer-literal">true</span></li>` +
+			`<li><span class="mortyviewer-literal">null</span></li>` +
+			`<li><span class="mortyviewer-string">&#34;&lt;i&gt;&#34;</span></li>` +
+			`</ul>]</details></li>` +
+			`<li><span class="mortyviewer-key">&#34;c&#34;</span>: <span>{}</span></li>` +
+			`</ul>}</details></div>`,
+	},
+	&StringTestCase{
+		`1.5e3`,
+		`<div class="mortyviewer-json"><span class="mortyviewer-number">1.5e3</span></div>`,
+	},
+	&StringTestCase{
+		`{"a": 1`,
+		``,
+	},
+	&StringTestCase{
+		`{} {}`,
+		``,
+	},
+	&StringTestCase{
+		strings.Repeat("[", MAX_JSON_DEPTH+2) + strings.Repeat("]", MAX_JSON_DEPTH+2),
+		``,
+	},
+}
+
+var xmlTestData []*StringTestCase = []*StringTestCase{
+	&StringTestCase{
+		`<?xml version="1.0"?><!-- c --><a:r xmlns:a="urn:a" id="1"><b>x &amp; &lt;i&gt;</b><c/><d>t<e/></d></a:r>`,
+		`<div class="mortyviewer-xml">` +
+			`<div><span class="mortyviewer-comment">&lt;?xml version=&#34;1.0&#34;?&gt;</span></div>` +
+			`<div><span class="mortyviewer-comment">&lt;!-- c --&gt;</span></div>` +
+			`<div><details open><summary><span class="mortyviewer-tag">&lt;a:r</span>` +
+			` <span class="mortyviewer-key">xmlns:a</span>=<span class="mortyviewer-string">&#34;urn:a&#34;</span>` +
+			` <span class="mortyviewer-key">id</span>=<span class="mortyviewer-string">&#34;1&#34;</span>` +
+			`<span class="mortyviewer-tag">&gt;</span></summary><ul>` +
+			`<li><span class="mortyviewer-tag">&lt;b</span><span class="mortyviewer-tag">&gt;</span>` +
+			`<span class="mortyviewer-string">x &amp; &lt;i&gt;</span><span class="mortyviewer-tag">&lt;/b&gt;</span></li>` +
+			`<li><span class="mortyviewer-tag">&lt;c</span><span class="mortyviewer-tag">/&gt;</span></li>` +
+			`<li><details open><summary><span class="mortyviewer-tag">&lt;d</span><span class="mortyviewer-tag">&gt;</span></summary><ul>` +
+			`<li><span class="mortyviewer-string">t</span></li>` +
+			`<li><span class="mortyviewer-tag">&lt;e</span><span class="mortyviewer-tag">/&gt;</span></li>` +
+			`</ul><span class="mortyviewer-tag">&lt;/d&gt;</span></details></li>` +
+			`</ul><span class="mortyviewer-tag">&lt;/a:r&gt;</span></details></div></div>`,
+	},
+	&StringTestCase{
+		`<!DOCTYPE r [<!ENTITY x "expanded">]><r>&x;</r>`,
+		``,
+	},
+	&StringTestCase{
+		`<r><a></b></r>`,
+		``,
+	},
+	&StringTestCase{
+		`<r>`,
+		``,
+	},
+	&StringTestCase{
+		`not XML`,
+		``,
+	},
+	&StringTestCase{
+		strings.Repeat("<a>", MAX_XML_DEPTH+2) + strings.Repeat("</a>", MAX_XML_DEPTH+2),
+		``,
+	},
+}
+
+func TestText(t *testing.T) {
+	for _, testCase := range textTestData {
+		out := bytes.NewBuffer(nil)
+		Text(out, []byte(testCase.Input))
+		if out.String() != testCase.ExpectedOutput {
+			t.Errorf(`Text viewer error. Input: "%s", Expected: "%s", Got: "%s"`, testCase.Input, testCase.ExpectedOutput, out.String())
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	for _, testCase := range jsonTestData {
+		out := bytes.NewBuffer(nil)
+		err := JSON(out, []byte(testCase.Input))
+		if out.String() != testCase.ExpectedOutput || (err == nil) != (testCase.ExpectedOutput != "") {
+			t.Errorf(`JSON viewer error. Input: "%s", Expected: "%s", Got: "%s" %v`, testCase.Input, testCase.ExpectedOutput, out.String(), err)
+		}
+	}
+}
+
+func TestXML(t *testing.T) {
+	for _, testCase := range xmlTestData {
+		out := bytes.NewBuffer(nil)
+		err := XML(out, []byte(testCase.Input))
+		if out.String() != testCase.ExpectedOutput || (err == nil) != (testCase.ExpectedOutput != "") {
+			t.Errorf(`XML viewer error. Input: "%s", Expected: "%s", Got: "%s" %v`, testCase.Input, testCase.ExpectedOutput, out.String(), err)
+		}
+	}
+}
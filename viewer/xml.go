@@ -0,0 +1,136 @@
+package viewer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// xmlNode is an element, or a leaf with its class: a text, a comment, a processing instruction
+// or a directive.
+type xmlNode struct {
+	start    xml.StartElement
+	children []*xmlNode
+	class    string
+	text     string
+}
+
+// XML writes an XML document as a tree of elements. The document is read as UTF-8, whatever its
+// encoding declaration, and the entities declared by its DTD are not expanded. Nothing is written
+// if the document is invalid.
+func XML(w io.Writer, data []byte) error {
+	root, err := parseXML(data)
+	if err != nil {
+		return err
+	}
+	out := bytes.NewBuffer(nil)
+	out.WriteString(`<div class="mortyviewer-xml">`)
+	for _, n := range root.children {
+		out.WriteString("<div>")
+		renderXMLNode(out, n)
+		out.WriteString("</div>")
+	}
+	out.WriteString("</div>")
+	_, err = out.WriteTo(w)
+	return err
+}
+
+// parseXML returns the tree of the document, under a root node without name. The namespace
+// prefixes are kept.
+func parseXML(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	hasElement := false
+	for {
+		token, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(stack) > MAX_XML_DEPTH {
+				return nil, errors.New("XML document too deep")
+			}
+			n := &xmlNode{start: t.Copy()}
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+			hasElement = true
+		case xml.EndElement:
+			if len(stack) == 1 || parent.start.Name != t.Name {
+				return nil, errors.New("invalid XML: unexpected end element " + xmlName(t.Name))
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if text := strings.TrimSpace(string(t)); text != "" {
+				parent.children = append(parent.children, &xmlNode{class: "mortyviewer-string", text: text})
+			}
+		case xml.Comment:
+			parent.children = append(parent.children, &xmlNode{class: "mortyviewer-comment", text: "<!--" + string(t) + "-->"})
+		case xml.ProcInst:
+			parent.children = append(parent.children, &xmlNode{class: "mortyviewer-comment", text: "<?" + t.Target + " " + string(t.Inst) + "?>"})
+		case xml.Directive:
+			parent.children = append(parent.children, &xmlNode{class: "mortyviewer-comment", text: "<!" + string(t) + ">"})
+		}
+	}
+	if len(stack) != 1 || !hasElement {
+		return nil, errors.New("invalid XML: unexpected end of document")
+	}
+	return root, nil
+}
+
+// renderXMLNode writes the elements with children as a <details> element, open by default. The
+// elements with a single text are written on one line.
+func renderXMLNode(out *bytes.Buffer, n *xmlNode) {
+	if n.class != "" {
+		fmt.Fprintf(out, `<span class="%s">%s</span>`, n.class, html.EscapeString(n.text))
+		return
+	}
+	endTag := fmt.Sprintf(`<span class="mortyviewer-tag">&lt;/%s&gt;</span>`, html.EscapeString(xmlName(n.start.Name)))
+	switch {
+	case len(n.children) == 0:
+		writeStartTag(out, n.start, "/&gt;")
+	case len(n.children) == 1 && n.children[0].class == "mortyviewer-string":
+		writeStartTag(out, n.start, "&gt;")
+		renderXMLNode(out, n.children[0])
+		out.WriteString(endTag)
+	default:
+		out.WriteString("<details open><summary>")
+		writeStartTag(out, n.start, "&gt;")
+		out.WriteString("</summary><ul>")
+		for _, child := range n.children {
+			out.WriteString("<li>")
+			renderXMLNode(out, child)
+			out.WriteString("</li>")
+		}
+		fmt.Fprintf(out, "</ul>%s</details>", endTag)
+	}
+}
+
+func writeStartTag(out *bytes.Buffer, start xml.StartElement, end string) {
+	fmt.Fprintf(out, `<span class="mortyviewer-tag">&lt;%s</span>`, html.EscapeString(xmlName(start.Name)))
+	for _, attr := range start.Attr {
+		fmt.Fprintf(out, ` <span class="mortyviewer-key">%s</span>=<span class="mortyviewer-string">%s</span>`,
+			html.EscapeString(xmlName(attr.Name)), html.EscapeString(`"`+attr.Value+`"`))
+	}
+	fmt.Fprintf(out, `<span class="mortyviewer-tag">%s</span>`, end)
+}
+
+// xmlName returns the name with its namespace prefix, as read by RawToken.
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}